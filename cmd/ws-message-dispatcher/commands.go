@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/config"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/dynamodb"
+)
+
+const usage = `usage: ws-message-dispatcher [command] [flags]
+
+without command the dispatcher service is started. Every config key can be set with a
+flag named after it (--lambda.function=name) overriding its env var (LAMBDA_FUNCTION),
+which overrides the config file (--config=path), which overrides the defaults
+
+commands:
+  config validate [flags]           reports every problem of the config read with flags,
+                                    exits with 1 when there is any. Unknown config file keys
+                                    are warnings, the service starts with them too
+  config print [flags]              prints the effective value of every config key and its
+                                    source, secrets are redacted
+  migrate users-index [index-name]  prints the users table GSI definition, apply it with
+                                    aws dynamodb update-table --cli-input-json file://index.json
+`
+
+// runCommand runs the command given in args and returns the process exit code
+func runCommand(args []string) int {
+	switch {
+	case len(args) >= 2 && args[0] == "config" && args[1] == "validate":
+		return validateConfig(args[2:])
+
+	case len(args) >= 2 && args[0] == "config" && args[1] == "print":
+		return printConfig(args[2:])
+
+	case len(args) >= 2 && args[0] == "migrate" && args[1] == "users-index":
+		return migrateUsersIndex(args[2:])
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+func validateConfig(args []string) int {
+	conf, problems, warnings := config.Validate(args)
+	if len(conf.File) > 0 {
+		fmt.Println("config file:", conf.File)
+	}
+
+	for _, w := range warnings {
+		fmt.Println("warning:", w)
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("config is valid")
+		return 0
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("%d config problems found\n", len(problems))
+	return 1
+}
+
+func printConfig(args []string) int {
+	conf, err := config.Read(args)
+	if err != nil {
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSOURCE\tENV\tVALUE")
+	for _, value := range conf.Values() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", value.Key, value.Source, value.Env, formatValue(value.Value))
+	}
+	if err = w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// formatValue prints strings, lists and durations as they are set, the rest as json
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case time.Duration:
+		return v.String()
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(raw)
+}
+
+func migrateUsersIndex(args []string) int {
+	var indexName string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		indexName, args = args[0], args[1:]
+	}
+
+	cnf, err := config.Read(args)
+	if err != nil {
+		return 1
+	}
+
+	if len(indexName) == 0 {
+		indexName = cnf.Dynamo.UsersIndex
+	}
+	if len(indexName) == 0 {
+		indexName = dynamodb.DefaultUsersIndex
+	}
+
+	definition, err := dynamodb.UsersIndexDefinition(cnf.Dynamo.UsersTable, indexName, cnf.Store.ConnectionAttributes)
+	if err == nil {
+		err = printCLIInput(definition)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// printCLIInput prints input as aws cli json input, unset fields are dropped because the cli
+// rejects nulls
+func printCLIInput(input interface{}) error {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	var decoded interface{}
+	if err = json.Unmarshal(raw, &decoded); err != nil {
+		return err
+	}
+
+	definition, err := json.MarshalIndent(dropNulls(decoded), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(definition))
+	return nil
+}
+
+func dropNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = dropNulls(item)
+		}
+	case []interface{}:
+		for idx, item := range v {
+			v[idx] = dropNulls(item)
+		}
+	}
+	return value
+}
@@ -1,36 +1,245 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"os"
+	"strings"
 
 	"github.com/boletia/ws-message-dispatcher/config"
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/boletia/ws-message-dispatcher/pkg/certs"
+	"github.com/boletia/ws-message-dispatcher/pkg/eventconfig"
+	"github.com/boletia/ws-message-dispatcher/pkg/health"
+	"github.com/boletia/ws-message-dispatcher/pkg/reaper"
+	"github.com/boletia/ws-message-dispatcher/pkg/registry"
+	"github.com/boletia/ws-message-dispatcher/pkg/reload"
 	"github.com/boletia/ws-message-dispatcher/pkg/sender"
 	"github.com/boletia/ws-message-dispatcher/pkg/service"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/cache"
 	"github.com/boletia/ws-message-dispatcher/pkg/store/dynamodb"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/memory"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/redis"
 	"github.com/labstack/echo"
 	echopprof "github.com/sevenNt/echo-pprof"
 	log "github.com/sirupsen/logrus"
 )
 
+// apiGateway is the gateway type whose connections are cached
+const apiGateway = "api-gateway"
+
 func main() {
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp:          true,
 		DisableLevelTruncation: true,
 	})
 
-	cnf, err := config.Read()
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	cnf, err := config.Read(os.Args[1:])
+	if err != nil {
+		os.Exit(1)
+	}
+
+	breakers := breaker.New(breaker.Settings{
+		FailureThreshold: cnf.Breaker.FailureThreshold,
+		OpenTimeout:      cnf.Breaker.OpenTimeout,
+		HalfOpenRequests: cnf.Breaker.HalfOpenRequests,
+	})
+
+	tracker := health.New(health.Settings{
+		UnhealthyAfter: cnf.Health.UnhealthyAfter,
+		ProbeInterval:  cnf.Health.ProbeInterval,
+		ProbeTimeout:   cnf.Health.ProbeTimeout,
+		ProbePath:      cnf.Health.ProbePath,
+		LatencyWeight:  cnf.Health.LatencyWeight,
+	})
+	tracker.Start()
+
+	backend, err := newStore(cnf)
 	if err != nil {
+		log.WithFields(log.Fields{"error": err, "backend": cnf.Store.Backend}).Error("unable to create store")
 		os.Exit(1)
 	}
+	// every component reads through db so config reloads can swap the backend
+	db := store.NewSwappable(backend)
+	senders := sender.NewSwappable(newSender(cnf, breakers))
+
+	transport := service.ChatTransportSettings{
+		MaxIdleConnsPerHost: cnf.Chat.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cnf.Chat.IdleConnTimeout,
+		DialTimeout:         cnf.Chat.DialTimeout,
+		KeepAlive:           cnf.Chat.KeepAlive,
+	}
+
+	options := []service.Option{}
+	serverTypes := make([]service.ServerType, 0, len(cnf.ServerTypes))
+	serverTypeNames := make([]string, 0, len(cnf.ServerTypes))
+	for _, st := range cnf.ServerTypes {
+		if st.TLS.Enabled {
+			reloader, err := certs.New(certs.Settings{
+				CAFile:             st.TLS.CAFile,
+				CertFile:           st.TLS.CertFile,
+				KeyFile:            st.TLS.KeyFile,
+				ServerName:         st.TLS.ServerName,
+				InsecureSkipVerify: st.TLS.InsecureSkipVerify,
+				ReloadInterval:     st.TLS.ReloadInterval,
+			})
+			if err != nil {
+				log.WithFields(log.Fields{"error": err, "server_type": st.Name}).Error("unable to load tls certificates")
+				os.Exit(1)
+			}
+			reloader.Start()
+
+			tlsTransport := transport
+			tlsTransport.TLS = reloader
+			options = append(options, service.WithServerTypeClient(st.Name, service.NewChatClient(tlsTransport)))
+		}
+
+		serverTypes = append(serverTypes, service.ServerType{
+			Name:           st.Name,
+			GatewayType:    st.GatewayType,
+			Scheme:         st.Scheme,
+			Path:           st.Path,
+			Payload:        st.Payload,
+			EnvelopeKey:    st.EnvelopeKey,
+			EnvelopeFields: st.EnvelopeFields,
+		})
+		serverTypeNames = append(serverTypeNames, st.Name)
+	}
 
-	srv := service.New(
-		dynamodb.New(cnf),
-		sender.New(cnf.Lambda.Region, cnf.Lambda.Function),
+	servers := registry.New(db, serverTypeNames, cnf.Chat.RegistryRefresh)
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), cnf.Timeouts.Lookup)
+	if err := servers.Load(loadCtx); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("unable to load chat servers registry")
+	}
+	cancelLoad()
+	servers.Start()
+
+	eventConfigs := eventconfig.New(db, cnf.EventConfig.Refresh)
+	loadCtx, cancelLoad = context.WithTimeout(context.Background(), cnf.Timeouts.Lookup)
+	if err := eventConfigs.Load(loadCtx); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("unable to load event configs")
+	}
+	cancelLoad()
+	eventConfigs.Start()
+
+	gatewayTimeouts := make(map[string]service.Timeouts, len(cnf.Timeouts.Gateways))
+	for gatewayType, timeouts := range cnf.Timeouts.Gateways {
+		gatewayTimeouts[gatewayType] = service.Timeouts(timeouts)
+	}
+
+	options = append(options,
+		service.WithBreakers(breakers),
+		service.WithChatClient(service.NewChatClient(transport)),
+		service.WithEventConfigs(eventConfigs),
+		service.WithHealth(tracker),
+		service.WithRouting(service.RoutingSettings{
+			Mode:         cnf.Chat.Routing,
+			Replicas:     cnf.Chat.HashReplicas,
+			VirtualNodes: cnf.Chat.HashVirtualNodes,
+		}),
+		service.WithServerRegistry(servers),
+		service.WithServerRegistrar(db, cnf.Registration.TTL),
+		service.WithServerTypes(serverTypes),
+		service.WithTimeouts(service.Timeouts{
+			Lookup:  cnf.Timeouts.Lookup,
+			Send:    cnf.Timeouts.Send,
+			Overall: cnf.Timeouts.Overall,
+		}, gatewayTimeouts),
 	)
 
+	clients := liveClients{
+		db:         db,
+		senders:    senders,
+		breakers:   breakers,
+		refreshers: []refresher{servers, eventConfigs},
+	}
+
+	if cnf.Cache.TTL > 0 {
+		lookup := cnf.Timeouts.Lookup
+		if timeouts, exists := cnf.Timeouts.Gateways[apiGateway]; exists && timeouts.Lookup > 0 {
+			lookup = timeouts.Lookup
+		}
+		connections := cache.New(db, cnf.Cache.TTL, lookup)
+		clients.invalidate = connections.InvalidateAll
+		options = append(options, service.WithConnectionCache(connections))
+	}
+
+	if cnf.Reaper.Enabled {
+		reaps := reaper.New(db, reaper.Settings{
+			MaxAge:    cnf.Reaper.MaxAge,
+			Interval:  cnf.Reaper.Interval,
+			BatchSize: cnf.Reaper.BatchSize,
+			Rate:      cnf.Reaper.Rate,
+			DryRun:    cnf.Reaper.DryRun,
+		})
+		reaps.Start()
+		options = append(options, service.WithReaper(reaps))
+	}
+
+	reloads := reload.New(cnf, func() (config.Config, error) {
+		return config.Read(os.Args[1:])
+	}, clients.apply, reload.Settings{
+		File:          cnf.File,
+		WatchInterval: cnf.Reload.WatchInterval,
+	})
+	reloads.Start()
+	options = append(options, service.WithReloader(reloads))
+
+	srv := service.New(db, senders, options...)
+	go srv.ExpireServers(cnf.Registration.ExpireInterval)
+
 	e := echo.New()
 	e.POST("/", srv.TakeIn)
+	e.GET("/admin/breakers", srv.Breakers)
+	e.GET("/admin/chat-servers/health", srv.ChatServersHealth)
+	e.GET("/admin/chat-servers", srv.ChatServers)
+	e.POST("/admin/chat-servers/refresh", srv.RefreshChatServers)
+	e.GET("/admin/event-configs", srv.EventConfigs)
+	e.POST("/admin/event-configs/refresh", srv.RefreshEventConfigs)
+	e.GET("/admin/reaper", srv.Reaper)
+	e.POST("/admin/reaper/run", srv.RunReaper)
+	e.GET("/admin/config/reload", srv.ConfigReload)
+	e.POST("/admin/config/reload", srv.RunConfigReload)
+	e.POST("/chat-servers/register", srv.RegisterServer)
+	e.POST("/chat-servers/heartbeat", srv.HeartbeatServer)
+	e.POST("/chat-servers/deregister", srv.DeregisterServer)
+	e.POST("/connections/invalidate", srv.InvalidateConnections)
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
 	echopprof.Wrap(e)
 
 	e.Logger.Fatal(e.Start(cnf.Service.Host))
 }
+
+// newSender creates the api-gateway sender of cnf
+func newSender(cnf config.Config, breakers *breaker.Set) sender.MessageSender {
+	if cnf.Lambda.Sender == config.SenderLog {
+		log.Warn("api-gateway messages are only logged, lambda.sender is log")
+		return sender.NewLog()
+	}
+	return sender.New(cnf.Lambda.Region, cnf.Lambda.Function, breakers)
+}
+
+func newStore(cnf config.Config) (store.Store, error) {
+	switch cnf.Store.Backend {
+	case config.BackendRedis:
+		return redis.New(redis.Settings{
+			Addr:                 cnf.Redis.Addr,
+			Password:             cnf.Redis.Password,
+			DB:                   cnf.Redis.DB,
+			KeyPrefix:            cnf.Redis.KeyPrefix,
+			ConnectionAttributes: cnf.Store.ConnectionAttributes,
+		})
+	case config.BackendMemory:
+		if len(cnf.Memory.Fixture) == 0 {
+			return memory.New(), nil
+		}
+		return memory.Load(cnf.Memory.Fixture)
+	}
+
+	return dynamodb.New(cnf)
+}
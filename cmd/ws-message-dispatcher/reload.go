@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/boletia/ws-message-dispatcher/config"
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/boletia/ws-message-dispatcher/pkg/sender"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+)
+
+// storeKeys prefixes the config keys the store is built from
+var storeKeys = []string{"store.", "dynamodb.", "redis.", "memory."}
+
+// refresher reloads what it read from the store
+type refresher interface {
+	Refresh()
+}
+
+// liveClients are the clients config reloads rebuild and swap
+type liveClients struct {
+	db       *store.Swappable
+	senders  *sender.Swappable
+	breakers *breaker.Set
+	// refreshers read the store again once it is swapped
+	refreshers []refresher
+	// invalidate drops the connections cached from the previous store
+	invalidate func()
+}
+
+// apply rebuilds the store and the sender when their keys changed, nothing is swapped when
+// the new store can't be created
+func (lc liveClients) apply(next config.Config, changed []string) error {
+	var db store.Store
+	if changedAny(changed, storeKeys...) {
+		var err error
+		if db, err = newStore(next); err != nil {
+			return err
+		}
+	}
+
+	if changedAny(changed, "lambda.") {
+		lc.senders.Swap(newSender(next, lc.breakers))
+	}
+
+	if db != nil {
+		lc.db.Swap(db)
+		if lc.invalidate != nil {
+			lc.invalidate()
+		}
+		for _, r := range lc.refreshers {
+			r.Refresh()
+		}
+	}
+
+	return nil
+}
+
+func changedAny(changed []string, prefixes ...string) bool {
+	for _, key := range changed {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,8 +2,13 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +18,55 @@ const (
 	defaultDynamoServersDBTable  = "chat-servers"
 	defaultDynamoChatConfigTable = "streaming-dispatcher-config"
 	defaultHTTPHost              = ":8888"
+	defaultBreakerFailures       = 5
+	defaultBreakerOpenTimeout    = 30 * time.Second
+	defaultBreakerHalfOpen       = 1
+	defaultChatMaxIdlePerHost    = 32
+	defaultChatIdleConnTimeout   = 90 * time.Second
+	defaultChatDialTimeout       = 2 * time.Second
+	defaultChatKeepAlive         = 30 * time.Second
+	defaultChatRouting           = "broadcast"
+	defaultChatHashReplicas      = 2
+	defaultChatHashVirtualNodes  = 100
+	defaultChatRegistryRefresh   = 30 * time.Second
+	defaultHealthUnhealthyAfter  = 3
+	defaultHealthProbeInterval   = 5 * time.Second
+	defaultHealthProbeTimeout    = time.Second
+	defaultHealthLatencyWeight   = 0.2
+	defaultRegistrationTTL       = 30 * time.Second
+	defaultRegistrationExpire    = 10 * time.Second
+	defaultCacheTTL              = 2 * time.Second
+	defaultEventConfigRefresh    = 30 * time.Second
+	defaultReaperMaxAge          = 24 * time.Hour
+	defaultReaperInterval        = time.Hour
+	defaultReaperBatchSize       = 25
+	defaultReaperRate            = 100.0
+	defaultReloadWatchInterval   = 10 * time.Second
+	defaultServerTypeName        = "chat"
+	defaultServerTypeGateway     = "chat-server-v2"
+	defaultServerTypeScheme      = "http"
+	defaultServerTypePath        = "/publish/chat/"
+	defaultServerTypePayload     = "full"
+	defaultServerTypeTLSScheme   = "https"
+	defaultTLSReloadInterval     = time.Minute
+	defaultTimeoutLookup         = 5 * time.Second
+	defaultTimeoutSend           = 5 * time.Second
+	defaultTimeoutOverall        = 15 * time.Second
+	reservedGatewayType          = "api-gateway"
+	defaultRedisAddr             = "localhost:6379"
+	defaultRedisKeyPrefix        = "ws-dispatcher:"
+
+	// BackendDynamoDB stores connections and chat servers on DynamoDB tables
+	BackendDynamoDB = "dynamodb"
+	// BackendRedis stores connections and chat servers on redis sets
+	BackendRedis = "redis"
+	// BackendMemory keeps connections and chat servers in memory, seeded from memory.fixture
+	BackendMemory = "memory"
+
+	// SenderLambda sends api-gateway messages through the lambda.function lambda
+	SenderLambda = "lambda"
+	// SenderLog only logs api-gateway messages, for local development without AWS
+	SenderLog = "log"
 )
 
 var (
@@ -20,28 +74,73 @@ var (
 	configLocalPath                 = "./config"
 	configType                      = "yaml"
 	configFileName                  = "ws-message-dispatcher"
+	configFileFlag                  = "config"
 	configDynamoRegion              = "dynamodb.region"
 	configDynamoUsersTableName      = "dynamodb.users-table"
 	configDynamoServersTableName    = "dynamodb.servers-table"
 	configDynamoChatConfigTableName = "dynamodb.chat-config-table"
+	configDynamoUsersIndex          = "dynamodb.users-index"
+	configDynamoScanSegments        = "dynamodb.scan-segments"
 	configLambdaRegion              = "lambda.region"
 	configLambdaFunctionName        = "lambda.function"
+	configLambdaSender              = "lambda.sender"
 	configServiceHost               = "http.host"
-
-	envConfigDynamoRegion              = "DYNAMODB_REGION"
-	envConfigDynamoUsersTableName      = "DYNAMODB_USERS_TABLE"
-	envConfigDynamoServersTableName    = "DYNAMODB_SERVERS_TABLE"
-	envConfigDyanmoChatConfigTableName = "DYNAMODB_CHATCONFIG_TABLE"
-	envConfigLambdaRegion              = "LAMBDA_REGION"
-	envConfigLambdaFunctionName        = "LAMBDA_FUNCTION"
-	envConfigServiceHost               = "HTTP_HOST"
+	configBreakerFailureThreshold   = "breaker.failure-threshold"
+	configBreakerOpenTimeout        = "breaker.open-timeout"
+	configBreakerHalfOpenRequests   = "breaker.half-open-requests"
+	configChatMaxIdleConnsPerHost   = "chat.max-idle-conns-per-host"
+	configChatIdleConnTimeout       = "chat.idle-conn-timeout"
+	configChatDialTimeout           = "chat.dial-timeout"
+	configChatKeepAlive             = "chat.keep-alive"
+	configChatRouting               = "chat.routing"
+	configChatHashReplicas          = "chat.hash-replicas"
+	configChatHashVirtualNodes      = "chat.hash-virtual-nodes"
+	configChatRegistryRefresh       = "chat.registry-refresh"
+	configHealthUnhealthyAfter      = "health.unhealthy-after"
+	configHealthProbeInterval       = "health.probe-interval"
+	configHealthProbeTimeout        = "health.probe-timeout"
+	configHealthProbePath           = "health.probe-path"
+	configHealthLatencyWeight       = "health.latency-weight"
+	configRegistrationTTL           = "registration.ttl"
+	configRegistrationExpire        = "registration.expire-interval"
+	configCacheTTL                  = "cache.ttl"
+	configEventConfigRefresh        = "event-config.refresh"
+	configStoreBackend              = "store.backend"
+	configStoreConnectionAttributes = "store.connection-attributes"
+	configRedisAddr                 = "redis.addr"
+	configRedisPassword             = "redis.password"
+	configRedisDB                   = "redis.db"
+	configRedisKeyPrefix            = "redis.key-prefix"
+	configMemoryFixture             = "memory.fixture"
+	configReaperEnabled             = "reaper.enabled"
+	configReaperMaxAge              = "reaper.max-age"
+	configReaperInterval            = "reaper.interval"
+	configReaperBatchSize           = "reaper.batch-size"
+	configReaperRate                = "reaper.rate"
+	configReaperDryRun              = "reaper.dry-run"
+	configReloadWatchInterval       = "reload.watch-interval"
+	configServerTypes               = "server-types"
+	configTimeoutLookup             = "timeouts.lookup"
+	configTimeoutSend               = "timeouts.send"
+	configTimeoutOverall            = "timeouts.overall"
+	configTimeoutGateways           = "timeouts.gateways"
 
 	errMissingConfiguration       = errors.New("missing configuration")
 	errUnableToReadConfigFile     = errors.New("unable to read config file")
+	errInvalidFlags               = errors.New("invalid flags")
 	errEmptyDynamoRegion          = errors.New("empty dynamo region")
 	errEmptyDynamoUsersTable      = errors.New("missing dynamo users table configuration")
 	errEmptyDynamoServersTable    = errors.New("missing dynamo servers table")
 	errEmptyDynamoChatConfigTable = errors.New("missing dynamo chat config table")
+	errInvalidServerTypes         = errors.New("invalid server types configuration")
+	errInvalidTimeouts            = errors.New("invalid timeouts configuration")
+	errInvalidStoreBackend        = errors.New("invalid store backend")
+	errInvalidSender              = errors.New("invalid lambda sender")
+	errInvalidReaper              = errors.New("invalid reaper configuration")
+	errInvalidReload              = errors.New("invalid reload configuration")
+	errInvalidRegistration        = errors.New("invalid registration configuration")
+	errInvalidValue               = errors.New("invalid value")
+	errUnknownKey                 = errors.New("unknown config key")
 )
 
 type dynamoConfig struct {
@@ -49,138 +148,491 @@ type dynamoConfig struct {
 	UsersTable      string
 	ServersTable    string
 	ChatConfigTable string
+	// UsersIndex is the users table GSI keyed on event_subdomain, the table is scanned when empty
+	UsersIndex string
+	// ScanSegments of the parallel scans, chosen from the table size when zero
+	ScanSegments int
 }
 
 type lambdaConfig struct {
 	Region   string
 	Function string
+	// Sender is lambda or log
+	Sender string
 }
 
 type http struct {
 	Host string
 }
 
-// Config holds service config
-type Config struct {
-	Dynamo  dynamoConfig
-	Lambda  lambdaConfig
-	Service http
+type breakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
 }
 
-// Read reads config service
-func Read() (Config, error) {
-	conf := Config{}
-	var err error
+type chatConfig struct {
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+	Routing             string
+	HashReplicas        int
+	HashVirtualNodes    int
+	RegistryRefresh     time.Duration
+}
 
-	err = readFromFile(&conf)
-	if err != nil && err != errUnableToReadConfigFile {
-		return Config{}, err
-	}
+type healthConfig struct {
+	UnhealthyAfter int
+	ProbeInterval  time.Duration
+	ProbeTimeout   time.Duration
+	ProbePath      string
+	LatencyWeight  float64
+}
 
-	if err == nil {
-		log.WithFields(log.Fields{
-			"dynamo-Region":           conf.Dynamo.Region,
-			"dynamo-users-table":      conf.Dynamo.UsersTable,
-			"dynamo-servers-table":    conf.Dynamo.ServersTable,
-			"dynamo-chatconfig-table": conf.Dynamo.ChatConfigTable,
-			"lambda-Region":           conf.Lambda.Region,
-			"lambda-function":         conf.Lambda.Function,
-			"http-host":               conf.Service.Host,
-		}).Info("config read from file")
+type registrationConfig struct {
+	TTL            time.Duration
+	ExpireInterval time.Duration
+}
 
-		return conf, nil
-	}
+type cacheConfig struct {
+	// TTL of cached user connections, zero disables the cache
+	TTL time.Duration
+}
 
-	log.Warn("unable to read config file, trying with env vars")
-	err = readFromEnv(&conf)
-	if err != nil {
-		return Config{}, err
+type eventConfigConfig struct {
+	// Refresh interval of the chat config table snapshot
+	Refresh time.Duration
+}
+
+type reaperConfig struct {
+	Enabled bool
+	// MaxAge of a connection before it is reaped, zero reaps only the ones flagged gone
+	MaxAge    time.Duration
+	Interval  time.Duration
+	BatchSize int
+	// Rate of deletes per second, zero is unlimited
+	Rate   float64
+	DryRun bool
+}
+
+type reloadConfig struct {
+	// WatchInterval between checks of the config file, zero only reloads on SIGHUP
+	WatchInterval time.Duration
+}
+
+type storeConfig struct {
+	// Backend is dynamodb, redis or memory
+	Backend string
+	// ConnectionAttributes read besides the connection id
+	ConnectionAttributes []string
+}
+
+type memoryConfig struct {
+	// Fixture is a json or yaml file the memory store is seeded from, it starts empty when unset
+	Fixture string
+}
+
+type redisConfig struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string
+}
+
+type stageTimeouts struct {
+	Lookup  time.Duration `mapstructure:"lookup"`
+	Send    time.Duration `mapstructure:"send"`
+	Overall time.Duration `mapstructure:"overall"`
+}
+
+type timeoutsConfig struct {
+	Lookup  time.Duration
+	Send    time.Duration
+	Overall time.Duration
+	// Gateways overrides the stage timeouts by gateway type
+	Gateways map[string]stageTimeouts
+}
+
+type tlsConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	CAFile             string        `mapstructure:"ca-file"`
+	CertFile           string        `mapstructure:"cert-file"`
+	KeyFile            string        `mapstructure:"key-file"`
+	ServerName         string        `mapstructure:"server-name"`
+	InsecureSkipVerify bool          `mapstructure:"insecure-skip-verify"`
+	ReloadInterval     time.Duration `mapstructure:"reload-interval"`
+}
+
+type serverTypeConfig struct {
+	Name           string                 `mapstructure:"name"`
+	GatewayType    string                 `mapstructure:"gateway-type"`
+	Scheme         string                 `mapstructure:"scheme"`
+	Path           string                 `mapstructure:"path"`
+	Payload        string                 `mapstructure:"payload"`
+	EnvelopeKey    string                 `mapstructure:"envelope-key"`
+	EnvelopeFields map[string]interface{} `mapstructure:"envelope-fields"`
+	TLS            tlsConfig              `mapstructure:"tls"`
+}
+
+// Config holds service config
+type Config struct {
+	Store        storeConfig
+	Dynamo       dynamoConfig
+	Redis        redisConfig
+	Memory       memoryConfig
+	Lambda       lambdaConfig
+	Service      http
+	Breaker      breakerConfig
+	Chat         chatConfig
+	Health       healthConfig
+	Registration registrationConfig
+	Cache        cacheConfig
+	EventConfig  eventConfigConfig
+	Reaper       reaperConfig
+	Reload       reloadConfig
+	ServerTypes  []serverTypeConfig
+	Timeouts     timeoutsConfig
+
+	// File is the config file read, empty when none was found
+	File string
+	// Sources of the effective value of every config key
+	Sources map[string]Source
+
+	values map[string]interface{}
+}
+
+// Read reads the config layering defaults, the config file, env vars and the flags of args,
+// every layer overrides the previous one
+func Read(args []string) (Config, error) {
+	conf, unknown, problems := load(args)
+	for _, p := range unknown {
+		log.WithFields(log.Fields{"key": p.Key}).Warn(p.Err.Error())
+	}
+	if len(problems) > 0 {
+		for _, p := range problems {
+			log.WithFields(log.Fields{"key": p.Key, "error": p.Detail}).Error(p.Err.Error())
+		}
+		return Config{}, problems[0].Err
 	}
 
 	log.WithFields(log.Fields{
+		"config-file":             conf.File,
+		"store-backend":           conf.Store.Backend,
+		"store-attributes":        conf.Store.ConnectionAttributes,
 		"dynamo-Region":           conf.Dynamo.Region,
 		"dynamo-users-table":      conf.Dynamo.UsersTable,
-		"dynamo-servers.table":    conf.Dynamo.ServersTable,
+		"dynamo-servers-table":    conf.Dynamo.ServersTable,
 		"dynamo-chatconfig-table": conf.Dynamo.ChatConfigTable,
+		"dynamo-users-index":      conf.Dynamo.UsersIndex,
+		"dynamo-scan-segments":    conf.Dynamo.ScanSegments,
+		"redis-addr":              conf.Redis.Addr,
 		"lambda-Region":           conf.Lambda.Region,
 		"lambda-function":         conf.Lambda.Function,
+		"lambda-sender":           conf.Lambda.Sender,
 		"http-host":               conf.Service.Host,
-	}).Info("config read from envs")
+		"breaker-failures":        conf.Breaker.FailureThreshold,
+		"breaker-open-timeout":    conf.Breaker.OpenTimeout,
+		"breaker-half-open":       conf.Breaker.HalfOpenRequests,
+		"chat-idle-per-host":      conf.Chat.MaxIdleConnsPerHost,
+		"chat-idle-timeout":       conf.Chat.IdleConnTimeout,
+		"chat-routing":            conf.Chat.Routing,
+		"health-unhealthy-after":  conf.Health.UnhealthyAfter,
+		"health-probe-interval":   conf.Health.ProbeInterval,
+		"registration-ttl":        conf.Registration.TTL,
+		"cache-ttl":               conf.Cache.TTL,
+		"reaper-enabled":          conf.Reaper.Enabled,
+		"reaper-dry-run":          conf.Reaper.DryRun,
+		"timeout-overall":         conf.Timeouts.Overall,
+	}).Info("config read")
+
+	overridden := log.Fields{}
+	for key, source := range conf.Sources {
+		if source != SourceDefault {
+			overridden[key] = source
+		}
+	}
+	log.WithFields(overridden).Info("config sources")
 
 	return conf, nil
 }
 
-func readFromEnv(conf *Config) error {
-	configVars := map[string]string{
-		envConfigDynamoRegion:              "",
-		envConfigDynamoUsersTableName:      "",
-		envConfigDynamoServersTableName:    "",
-		envConfigDyanmoChatConfigTableName: "",
-		envConfigLambdaRegion:              "",
-		envConfigLambdaFunctionName:        "",
-		envConfigServiceHost:               "",
+// load reads the config collecting every problem found, unknown holds the config file keys
+// no setting reads
+func load(args []string) (conf Config, unknown []Problem, problems []Problem) {
+	v := viper.New()
+	flags := pflag.NewFlagSet(configFileName, pflag.ContinueOnError)
+	configFile := flags.String(configFileFlag, "", "config file, "+configFileName+"."+configType+" is searched in "+configETCPath+" and "+configLocalPath+" when unset")
+	bindSettings(v, flags)
+
+	vd := &validation{}
+	if err := flags.Parse(args); err != nil {
+		vd.add("", errInvalidFlags, "%s", err)
+		return Config{}, nil, vd.problems
+	}
+
+	file, err := readFile(*configFile)
+	if err == nil {
+		err = v.MergeConfigMap(file.AllSettings())
+	}
+	if err != nil {
+		vd.add(configFileFlag, errUnableToReadConfigFile, "%s", err)
+		return Config{}, nil, vd.problems
+	}
+
+	conf = Config{File: file.ConfigFileUsed(), Sources: sources(file, flags)}
+	checkTypes(v, vd)
+	conf.values = values(v)
+	read(v, &conf, vd)
+
+	return conf, unknownKeys(file), vd.problems
+}
+
+// readFile reads path or the first config file found in the config paths when path is
+// empty, a missing config file is only an error when path is set
+func readFile(path string) (*viper.Viper, error) {
+	file := viper.New()
+	file.SetConfigType(configType)
+
+	if len(path) > 0 {
+		file.SetConfigFile(path)
+	} else {
+		file.AddConfigPath(configETCPath)
+		file.AddConfigPath(configLocalPath)
+		file.SetConfigName(configFileName)
+	}
+
+	err := file.ReadInConfig()
+	if _, notFound := err.(viper.ConfigFileNotFoundError); notFound {
+		log.Warn("config file not found, reading defaults, env vars and flags")
+		return file, nil
 	}
+	return file, err
+}
 
-	for key := range configVars {
-		viper.BindEnv(key)
+func read(v *viper.Viper, conf *Config, vd *validation) {
+	conf.Dynamo.Region = v.GetString(configDynamoRegion)
+	conf.Dynamo.UsersTable = v.GetString(configDynamoUsersTableName)
+	conf.Dynamo.ServersTable = v.GetString(configDynamoServersTableName)
+	conf.Dynamo.ChatConfigTable = v.GetString(configDynamoChatConfigTableName)
+	conf.Dynamo.UsersIndex = v.GetString(configDynamoUsersIndex)
+	conf.Dynamo.ScanSegments = v.GetInt(configDynamoScanSegments)
+	conf.Lambda.Region = v.GetString(configLambdaRegion)
+	conf.Lambda.Function = v.GetString(configLambdaFunctionName)
+	conf.Lambda.Sender = v.GetString(configLambdaSender)
+	conf.Service.Host = v.GetString(configServiceHost)
+	readBreaker(v, conf)
+	readChat(v, conf)
+	readHealth(v, conf)
+	readRegistration(v, conf, vd)
+	readCache(v, conf)
+	readReaper(v, conf, vd)
+	readStore(v, conf, vd)
+	readTimeouts(v, conf, vd)
+	readServerTypes(v, conf, vd)
+
+	conf.Reload.WatchInterval = v.GetDuration(configReloadWatchInterval)
+	if conf.Reload.WatchInterval < 0 {
+		vd.add(configReloadWatchInterval, errInvalidReload, "must not be negative, got %s", conf.Reload.WatchInterval)
+	}
 
-		if len(viper.GetString(key)) == 0 {
-			log.WithFields(log.Fields{
-				"variable": key,
-				"value":    viper.GetString(key),
-			}).Error("reading environment config")
-			return errMissingConfiguration
+	switch conf.Lambda.Sender {
+	case SenderLambda:
+		if len(conf.Lambda.Function) == 0 {
+			vd.add(configLambdaFunctionName, errMissingConfiguration, "lambda function is not set")
 		}
+	case SenderLog:
+	default:
+		vd.add(configLambdaSender, errInvalidSender, "%q is not %s or %s", conf.Lambda.Sender, SenderLambda, SenderLog)
+	}
+}
+
+func readBreaker(v *viper.Viper, conf *Config) {
+	conf.Breaker.FailureThreshold = v.GetInt(configBreakerFailureThreshold)
+	conf.Breaker.OpenTimeout = v.GetDuration(configBreakerOpenTimeout)
+	conf.Breaker.HalfOpenRequests = v.GetInt(configBreakerHalfOpenRequests)
+}
+
+func readChat(v *viper.Viper, conf *Config) {
+	conf.Chat.MaxIdleConnsPerHost = v.GetInt(configChatMaxIdleConnsPerHost)
+	conf.Chat.IdleConnTimeout = v.GetDuration(configChatIdleConnTimeout)
+	conf.Chat.DialTimeout = v.GetDuration(configChatDialTimeout)
+	conf.Chat.KeepAlive = v.GetDuration(configChatKeepAlive)
+	conf.Chat.Routing = v.GetString(configChatRouting)
+	conf.Chat.HashReplicas = v.GetInt(configChatHashReplicas)
+	conf.Chat.HashVirtualNodes = v.GetInt(configChatHashVirtualNodes)
+	conf.Chat.RegistryRefresh = v.GetDuration(configChatRegistryRefresh)
+}
+
+func readHealth(v *viper.Viper, conf *Config) {
+	conf.Health.UnhealthyAfter = v.GetInt(configHealthUnhealthyAfter)
+	conf.Health.ProbeInterval = v.GetDuration(configHealthProbeInterval)
+	conf.Health.ProbeTimeout = v.GetDuration(configHealthProbeTimeout)
+	conf.Health.ProbePath = v.GetString(configHealthProbePath)
+	conf.Health.LatencyWeight = v.GetFloat64(configHealthLatencyWeight)
+}
+
+func readRegistration(v *viper.Viper, conf *Config, vd *validation) {
+	conf.Registration.TTL = v.GetDuration(configRegistrationTTL)
+	conf.Registration.ExpireInterval = v.GetDuration(configRegistrationExpire)
 
-		configVars[key] = viper.GetString(key)
+	if conf.Registration.ExpireInterval <= 0 {
+		vd.add(configRegistrationExpire, errInvalidRegistration, "must be positive, got %s", conf.Registration.ExpireInterval)
 	}
+}
 
-	conf.Dynamo.Region = configVars[envConfigDynamoRegion]
-	conf.Dynamo.UsersTable = configVars[envConfigDynamoUsersTableName]
-	conf.Dynamo.ServersTable = configVars[envConfigDynamoServersTableName]
-	conf.Dynamo.ChatConfigTable = configVars[envConfigDyanmoChatConfigTableName]
-	conf.Lambda.Region = configVars[envConfigLambdaRegion]
-	conf.Lambda.Function = configVars[envConfigLambdaFunctionName]
-	conf.Service.Host = configVars[envConfigServiceHost]
+func readCache(v *viper.Viper, conf *Config) {
+	conf.Cache.TTL = v.GetDuration(configCacheTTL)
+	conf.EventConfig.Refresh = v.GetDuration(configEventConfigRefresh)
+}
 
-	return nil
+func readReaper(v *viper.Viper, conf *Config, vd *validation) {
+	conf.Reaper.Enabled = v.GetBool(configReaperEnabled)
+	conf.Reaper.MaxAge = v.GetDuration(configReaperMaxAge)
+	conf.Reaper.Interval = v.GetDuration(configReaperInterval)
+	conf.Reaper.BatchSize = v.GetInt(configReaperBatchSize)
+	conf.Reaper.Rate = v.GetFloat64(configReaperRate)
+	conf.Reaper.DryRun = v.GetBool(configReaperDryRun)
+
+	if conf.Reaper.MaxAge < 0 {
+		vd.add(configReaperMaxAge, errInvalidReaper, "must not be negative, got %s", conf.Reaper.MaxAge)
+	}
+	if conf.Reaper.Interval <= 0 {
+		vd.add(configReaperInterval, errInvalidReaper, "must be positive, got %s", conf.Reaper.Interval)
+	}
+	if conf.Reaper.BatchSize <= 0 {
+		vd.add(configReaperBatchSize, errInvalidReaper, "must be positive, got %d", conf.Reaper.BatchSize)
+	}
+	if conf.Reaper.Rate < 0 {
+		vd.add(configReaperRate, errInvalidReaper, "must not be negative, got %g", conf.Reaper.Rate)
+	}
 }
 
-func readFromFile(conf *Config) error {
-	viper.AddConfigPath(configETCPath)
-	viper.AddConfigPath(configLocalPath)
+func readStore(v *viper.Viper, conf *Config, vd *validation) {
+	conf.Store.Backend = v.GetString(configStoreBackend)
+	conf.Redis.Addr = v.GetString(configRedisAddr)
+	conf.Redis.Password = v.GetString(configRedisPassword)
+	conf.Redis.DB = v.GetInt(configRedisDB)
+	conf.Redis.KeyPrefix = v.GetString(configRedisKeyPrefix)
+	conf.Memory.Fixture = v.GetString(configMemoryFixture)
 
-	viper.SetConfigName(configFileName)
-	viper.SetConfigType(configType)
+	conf.Store.ConnectionAttributes = splitList(v.GetStringSlice(configStoreConnectionAttributes))
 
-	viper.SetDefault(configDynamoRegion, defaultRegion)
-	viper.SetDefault(configDynamoUsersTableName, defaultDynamoUsersDBTable)
-	viper.SetDefault(configDynamoServersTableName, defaultDynamoServersDBTable)
-	viper.SetDefault(configDynamoChatConfigTableName, defaultDynamoChatConfigTable)
-	viper.SetDefault(configServiceHost, defaultHTTPHost)
+	if _, err := store.Projection(conf.Store.ConnectionAttributes); err != nil {
+		vd.add(configStoreConnectionAttributes, err, "%v", conf.Store.ConnectionAttributes)
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		log.WithFields(log.Fields{
-			"error":       err,
-			"config_file": configFileName,
-		}).Error("unable to read config file")
-		return errUnableToReadConfigFile
+	switch conf.Store.Backend {
+	case BackendDynamoDB:
+		checkDynamo(conf, vd)
+	case BackendRedis, BackendMemory:
+	default:
+		vd.add(configStoreBackend, errInvalidStoreBackend, "%q is not %s, %s or %s", conf.Store.Backend, BackendDynamoDB, BackendRedis, BackendMemory)
 	}
+}
+
+// checkDynamo checks the dynamodb backend has its region and tables set
+func checkDynamo(conf *Config, vd *validation) {
+	required := []struct {
+		key   string
+		value string
+	}{
+		{configDynamoRegion, conf.Dynamo.Region},
+		{configDynamoUsersTableName, conf.Dynamo.UsersTable},
+		{configDynamoServersTableName, conf.Dynamo.ServersTable},
+		{configDynamoChatConfigTableName, conf.Dynamo.ChatConfigTable},
+	}
+	for _, r := range required {
+		if len(r.value) == 0 {
+			vd.add(r.key, errMissingConfiguration, "must be set with the %s backend", BackendDynamoDB)
+		}
+	}
+}
+
+// splitList splits the comma separated values of env vars and flags
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
 
-	conf.Dynamo.Region = viper.GetString(configDynamoRegion)
-	conf.Dynamo.UsersTable = viper.GetString(configDynamoUsersTableName)
-	conf.Dynamo.ServersTable = viper.GetString(configDynamoServersTableName)
-	conf.Dynamo.ChatConfigTable = viper.GetString(configDynamoChatConfigTableName)
-	conf.Lambda.Region = viper.GetString(configLambdaRegion)
-	conf.Lambda.Function = viper.GetString(configLambdaFunctionName)
-	conf.Service.Host = viper.GetString(configServiceHost)
+func readTimeouts(v *viper.Viper, conf *Config, vd *validation) {
+	conf.Timeouts.Lookup = v.GetDuration(configTimeoutLookup)
+	conf.Timeouts.Send = v.GetDuration(configTimeoutSend)
+	conf.Timeouts.Overall = v.GetDuration(configTimeoutOverall)
 
-	if len(conf.Lambda.Function) == 0 {
-		log.Error("lambda function does not set")
-		return errMissingConfiguration
+	if err := v.UnmarshalKey(configTimeoutGateways, &conf.Timeouts.Gateways); err != nil {
+		vd.add(configTimeoutGateways, errInvalidTimeouts, "%s", err)
 	}
 
-	return nil
+	stages := []struct {
+		key     string
+		timeout time.Duration
+	}{
+		{configTimeoutLookup, conf.Timeouts.Lookup},
+		{configTimeoutSend, conf.Timeouts.Send},
+		{configTimeoutOverall, conf.Timeouts.Overall},
+	}
+	for _, stage := range stages {
+		if stage.timeout <= 0 {
+			vd.add(stage.key, errInvalidTimeouts, "must be a positive duration, got %s", stage.timeout)
+		}
+	}
+}
+
+func readServerTypes(v *viper.Viper, conf *Config, vd *validation) {
+	if err := v.UnmarshalKey(configServerTypes, &conf.ServerTypes); err != nil {
+		vd.add(configServerTypes, errInvalidServerTypes, "%s", err)
+		return
+	}
+
+	if len(conf.ServerTypes) == 0 {
+		conf.ServerTypes = []serverTypeConfig{
+			{
+				Name:        defaultServerTypeName,
+				GatewayType: defaultServerTypeGateway,
+				Scheme:      defaultServerTypeScheme,
+				Path:        defaultServerTypePath,
+				Payload:     defaultServerTypePayload,
+			},
+		}
+	}
+
+	gatewayTypes := make(map[string]bool, len(conf.ServerTypes))
+	for idx := range conf.ServerTypes {
+		st := &conf.ServerTypes[idx]
+		key := fmt.Sprintf("%s[%d]", configServerTypes, idx)
+
+		if len(st.Name) == 0 || len(st.GatewayType) == 0 || st.GatewayType == reservedGatewayType || gatewayTypes[st.GatewayType] {
+			vd.add(key, errInvalidServerTypes, "server type %q needs a name and an unique gateway type other than %s, got %q", st.Name, reservedGatewayType, st.GatewayType)
+		}
+		gatewayTypes[st.GatewayType] = true
+
+		if len(st.Scheme) == 0 && st.TLS.Enabled {
+			st.Scheme = defaultServerTypeTLSScheme
+		}
+		if len(st.Scheme) == 0 {
+			st.Scheme = defaultServerTypeScheme
+		}
+		if st.TLS.Enabled && st.Scheme != defaultServerTypeTLSScheme {
+			vd.add(key, errInvalidServerTypes, "server type %q has tls enabled, its scheme must be %s, got %q", st.Name, defaultServerTypeTLSScheme, st.Scheme)
+		}
+		if st.TLS.ReloadInterval <= 0 {
+			st.TLS.ReloadInterval = defaultTLSReloadInterval
+		}
+		if (len(st.TLS.CertFile) == 0) != (len(st.TLS.KeyFile) == 0) {
+			vd.add(key, errInvalidServerTypes, "server type %q tls cert-file and key-file must be set together", st.Name)
+		}
+		if len(st.Payload) == 0 {
+			st.Payload = defaultServerTypePayload
+		}
+	}
 }
 
 // GetDynamoRegion gets dynamo region
@@ -214,3 +666,18 @@ func (c Config) GetChatConfigTable() (string, error) {
 	}
 	return c.Dynamo.ChatConfigTable, nil
 }
+
+// GetUsersIndex gets dynamo users table index, empty when the table must be scanned
+func (c Config) GetUsersIndex() string {
+	return c.Dynamo.UsersIndex
+}
+
+// GetScanSegments gets dynamo parallel scan segments, zero when chosen from the table size
+func (c Config) GetScanSegments() int {
+	return c.Dynamo.ScanSegments
+}
+
+// GetConnectionAttributes gets the connection attributes read besides the connection id
+func (c Config) GetConnectionAttributes() []string {
+	return c.Store.ConnectionAttributes
+}
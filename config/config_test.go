@@ -0,0 +1,210 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func configFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "ws-message-dispatcher-*.yaml")
+	if err != nil {
+		t.Fatalf("unable to create config file: %s", err)
+	}
+	t.Cleanup(func() { os.Remove(file.Name()) })
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatalf("unable to write config file: %s", err)
+	}
+	file.Close()
+	return file.Name()
+}
+
+func setenv(t *testing.T, env, value string) {
+	os.Setenv(env, value)
+	t.Cleanup(func() { os.Unsetenv(env) })
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "DYNAMODB_USERS_TABLE", EnvName("dynamodb.users-table"))
+	assert.Equal(t, "LAMBDA_FUNCTION", EnvName("lambda.function"))
+	assert.Equal(t, "CHAT_MAX_IDLE_CONNS_PER_HOST", EnvName("chat.max-idle-conns-per-host"))
+}
+
+func TestReadLayers(t *testing.T) {
+	file := configFile(t, `
+lambda:
+  region: "us-west-2"
+  function: "file-function"
+breaker:
+  failure-threshold: 7
+cache:
+  ttl: "5s"
+`)
+	setenv(t, "LAMBDA_FUNCTION", "env-function")
+	setenv(t, "CACHE_TTL", "10s")
+	setenv(t, "TIMEOUT_SEND", "3s")
+
+	conf, err := Read([]string{"--config", file, "--cache.ttl=20s"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, file, conf.File)
+	assert.Equal(t, defaultHTTPHost, conf.Service.Host)
+	assert.Equal(t, "us-west-2", conf.Lambda.Region)
+	assert.Equal(t, 7, conf.Breaker.FailureThreshold)
+	assert.Equal(t, "env-function", conf.Lambda.Function)
+	assert.Equal(t, 20*time.Second, conf.Cache.TTL)
+	assert.Equal(t, 3*time.Second, conf.Timeouts.Send)
+
+	assert.Equal(t, SourceDefault, conf.Sources[configServiceHost])
+	assert.Equal(t, SourceFile, conf.Sources[configLambdaRegion])
+	assert.Equal(t, SourceFile, conf.Sources[configBreakerFailureThreshold])
+	assert.Equal(t, SourceEnv, conf.Sources[configLambdaFunctionName])
+	assert.Equal(t, SourceEnv, conf.Sources[configTimeoutSend])
+	assert.Equal(t, SourceFlag, conf.Sources[configCacheTTL])
+	assert.Len(t, conf.Sources, len(settings))
+}
+
+func TestReadWithoutFile(t *testing.T) {
+	setenv(t, "STORE_CONNECTION_ATTRIBUTES", "user_id, language")
+
+	conf, err := Read([]string{"--lambda.function", "flag-function", "--config", ""})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "flag-function", conf.Lambda.Function)
+		assert.Equal(t, defaultRegion, conf.Lambda.Region)
+		assert.Equal(t, defaultDynamoUsersDBTable, conf.Dynamo.UsersTable)
+		assert.Equal(t, []string{"user_id", "language"}, conf.Store.ConnectionAttributes)
+		assert.Len(t, conf.ServerTypes, 1)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	file := configFile(t, `
+lambda:
+  function: "file-function"
+`)
+	tlsFile := configFile(t, `
+lambda:
+  function: "file-function"
+server-types:
+  - name: "chat"
+    gateway-type: "chat-server-v2"
+    scheme: "http"
+    tls:
+      enabled: true
+`)
+
+	testCases := []struct {
+		testName string
+		args     []string
+		err      error
+	}{
+		{testName: "UnknownFlagCase", args: []string{"--config", file, "--lambda.name=x"}, err: errInvalidFlags},
+		{testName: "MissingFileCase", args: []string{"--config", file + ".missing"}, err: errUnableToReadConfigFile},
+		{testName: "MissingFunctionCase", args: []string{"--config", file, "--lambda.function="}, err: errMissingConfiguration},
+		{testName: "InvalidBackendCase", args: []string{"--config", file, "--store.backend=mysql"}, err: errInvalidStoreBackend},
+		{testName: "TLSOverHTTPCase", args: []string{"--config", tlsFile}, err: errInvalidServerTypes},
+		{testName: "EmptyDynamoTableCase", args: []string{"--config", file, "--store.backend=dynamodb", "--dynamodb.users-table="}, err: errMissingConfiguration},
+		{testName: "InvalidSenderCase", args: []string{"--config", file, "--lambda.sender=sqs"}, err: errInvalidSender},
+		{testName: "ZeroExpireIntervalCase", args: []string{"--config", file, "--registration.expire-interval=0s"}, err: errInvalidRegistration},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			_, err := Read(c.args)
+			assert.Equal(t, c.err, err)
+		})
+	}
+}
+
+func TestChanges(t *testing.T) {
+	file := configFile(t, `
+lambda:
+  function: "file-function"
+`)
+
+	prev, err := Read([]string{"--config", file})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	next, err := Read([]string{"--config", file, "--lambda.function=next-function", "--http.host=:9999", "--cache.ttl=2s"})
+	if assert.NoError(t, err) {
+		live, restart := Changes(prev, next)
+		assert.Equal(t, []string{configLambdaFunctionName}, live)
+		assert.Equal(t, []string{configServiceHost}, restart)
+	}
+
+	live, restart := Changes(prev, prev)
+	assert.Empty(t, live)
+	assert.Empty(t, restart)
+}
+
+func TestValidate(t *testing.T) {
+	file := configFile(t, `
+lambda:
+  fucntion: "file-function"
+store:
+  backend: "mysql"
+reaper:
+  batch-size: 0
+  rate: -1
+timeouts:
+  send: "soon"
+  gateways:
+    chat-server-v2:
+      send: "2s"
+server-types:
+  - name: "chat"
+    gateway-type: "api-gateway"
+`)
+
+	_, problems, warnings := Validate([]string{"--config", file, "--cache.ttl=2"})
+
+	keys := make([]string, 0, len(problems))
+	for _, p := range problems {
+		keys = append(keys, p.Key)
+	}
+	assert.Equal(t, []string{
+		configTimeoutSend,
+		configReaperBatchSize,
+		configReaperRate,
+		configStoreBackend,
+		"server-types[0]",
+		configLambdaFunctionName,
+	}, keys)
+	assert.Equal(t, errInvalidValue, problems[0].Err)
+
+	assert.Equal(t, []Problem{{Key: "lambda.fucntion", Err: errUnknownKey, Detail: "not read by any setting"}}, warnings)
+}
+
+func TestValidateShippedConfig(t *testing.T) {
+	_, problems, warnings := Validate([]string{"--config", "ws-message-dispatcher.yaml"})
+	assert.Empty(t, problems)
+	assert.Empty(t, warnings)
+}
+
+func TestValues(t *testing.T) {
+	setenv(t, "REDIS_PASSWORD", "s3cr3t")
+
+	conf, err := Read([]string{"--lambda.function", "flag-function", "--config", ""})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	values := make(map[string]Value, len(settings))
+	for _, value := range conf.Values() {
+		values[value.Key] = value
+	}
+
+	assert.Len(t, values, len(settings))
+	assert.Equal(t, Value{Key: configRedisPassword, Value: Redacted, Source: SourceEnv, Env: "REDIS_PASSWORD"}, values[configRedisPassword])
+	assert.Equal(t, Value{Key: configLambdaFunctionName, Value: "flag-function", Source: SourceFlag, Env: "LAMBDA_FUNCTION"}, values[configLambdaFunctionName])
+	assert.Equal(t, Value{Key: configCacheTTL, Value: defaultCacheTTL, Source: SourceDefault, Env: "CACHE_TTL"}, values[configCacheTTL])
+	assert.Equal(t, Value{Key: configServerTypes, Source: SourceDefault}, values[configServerTypes])
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Source of an effective config value
+type Source string
+
+const (
+	// SourceDefault values are the built-in defaults
+	SourceDefault Source = "default"
+	// SourceFile values come from the config file, overriding the defaults
+	SourceFile Source = "file"
+	// SourceEnv values come from env vars, overriding the config file
+	SourceEnv Source = "env"
+	// SourceFlag values come from command line flags, overriding everything else
+	SourceFlag Source = "flag"
+)
+
+var envNames = strings.NewReplacer(".", "_", "-", "_")
+
+// setting maps a config key to its env var and flag: the env var is the key upper cased with
+// dots and dashes as underscores (dynamodb.users-table is DYNAMODB_USERS_TABLE) and the flag
+// is named after the key (--dynamodb.users-table)
+type setting struct {
+	key          string
+	defaultValue interface{}
+	// legacyEnv is still read when the mapped env var is unset
+	legacyEnv string
+	// fileOnly settings are lists or maps only read from the config file
+	fileOnly bool
+	// live settings are applied by config reloads, the rest need a restart
+	live bool
+	// secret values are redacted when the config is printed
+	secret bool
+}
+
+var settings = []setting{
+	{key: configStoreBackend, defaultValue: BackendDynamoDB, live: true},
+	{key: configStoreConnectionAttributes, defaultValue: []string{}, live: true},
+	{key: configDynamoRegion, defaultValue: defaultRegion, live: true},
+	{key: configDynamoUsersTableName, defaultValue: defaultDynamoUsersDBTable, live: true},
+	{key: configDynamoServersTableName, defaultValue: defaultDynamoServersDBTable, live: true},
+	{key: configDynamoChatConfigTableName, defaultValue: defaultDynamoChatConfigTable, legacyEnv: "DYNAMODB_CHATCONFIG_TABLE", live: true},
+	{key: configDynamoUsersIndex, defaultValue: "", live: true},
+	{key: configDynamoScanSegments, defaultValue: 0, live: true},
+	{key: configRedisAddr, defaultValue: defaultRedisAddr, live: true},
+	{key: configRedisPassword, defaultValue: "", live: true, secret: true},
+	{key: configRedisDB, defaultValue: 0, live: true},
+	{key: configRedisKeyPrefix, defaultValue: defaultRedisKeyPrefix, live: true},
+	{key: configMemoryFixture, defaultValue: "", live: true},
+	{key: configLambdaRegion, defaultValue: defaultRegion, live: true},
+	{key: configLambdaFunctionName, defaultValue: "", live: true},
+	{key: configLambdaSender, defaultValue: SenderLambda, live: true},
+	{key: configServiceHost, defaultValue: defaultHTTPHost},
+	{key: configBreakerFailureThreshold, defaultValue: defaultBreakerFailures},
+	{key: configBreakerOpenTimeout, defaultValue: defaultBreakerOpenTimeout},
+	{key: configBreakerHalfOpenRequests, defaultValue: defaultBreakerHalfOpen},
+	{key: configChatMaxIdleConnsPerHost, defaultValue: defaultChatMaxIdlePerHost},
+	{key: configChatIdleConnTimeout, defaultValue: defaultChatIdleConnTimeout},
+	{key: configChatDialTimeout, defaultValue: defaultChatDialTimeout},
+	{key: configChatKeepAlive, defaultValue: defaultChatKeepAlive},
+	{key: configChatRouting, defaultValue: defaultChatRouting},
+	{key: configChatHashReplicas, defaultValue: defaultChatHashReplicas},
+	{key: configChatHashVirtualNodes, defaultValue: defaultChatHashVirtualNodes},
+	{key: configChatRegistryRefresh, defaultValue: defaultChatRegistryRefresh},
+	{key: configHealthUnhealthyAfter, defaultValue: defaultHealthUnhealthyAfter},
+	{key: configHealthProbeInterval, defaultValue: defaultHealthProbeInterval},
+	{key: configHealthProbeTimeout, defaultValue: defaultHealthProbeTimeout},
+	{key: configHealthProbePath, defaultValue: ""},
+	{key: configHealthLatencyWeight, defaultValue: defaultHealthLatencyWeight},
+	{key: configRegistrationTTL, defaultValue: defaultRegistrationTTL},
+	{key: configRegistrationExpire, defaultValue: defaultRegistrationExpire},
+	{key: configCacheTTL, defaultValue: defaultCacheTTL},
+	{key: configEventConfigRefresh, defaultValue: defaultEventConfigRefresh},
+	{key: configReaperEnabled, defaultValue: false},
+	{key: configReaperMaxAge, defaultValue: defaultReaperMaxAge},
+	{key: configReaperInterval, defaultValue: defaultReaperInterval},
+	{key: configReaperBatchSize, defaultValue: defaultReaperBatchSize},
+	{key: configReaperRate, defaultValue: defaultReaperRate},
+	{key: configReaperDryRun, defaultValue: false},
+	{key: configReloadWatchInterval, defaultValue: defaultReloadWatchInterval},
+	{key: configTimeoutLookup, defaultValue: defaultTimeoutLookup, legacyEnv: "TIMEOUT_LOOKUP"},
+	{key: configTimeoutSend, defaultValue: defaultTimeoutSend, legacyEnv: "TIMEOUT_SEND"},
+	{key: configTimeoutOverall, defaultValue: defaultTimeoutOverall, legacyEnv: "TIMEOUT_OVERALL"},
+	{key: configTimeoutGateways, fileOnly: true},
+	{key: configServerTypes, fileOnly: true},
+}
+
+// EnvName gets the env var of a config key
+func EnvName(key string) string {
+	return strings.ToUpper(envNames.Replace(key))
+}
+
+func (s setting) envs() []string {
+	if s.fileOnly {
+		return nil
+	}
+	if len(s.legacyEnv) > 0 {
+		return []string{EnvName(s.key), s.legacyEnv}
+	}
+	return []string{EnvName(s.key)}
+}
+
+// bindSettings sets the defaults of v and binds every setting to its env vars and to a
+// flag of flags
+func bindSettings(v *viper.Viper, flags *pflag.FlagSet) {
+	for _, s := range settings {
+		if s.defaultValue != nil {
+			v.SetDefault(s.key, s.defaultValue)
+		}
+
+		envs := s.envs()
+		if len(envs) == 0 {
+			continue
+		}
+
+		// the legacy env var is bound instead of the mapped one when only it is set
+		env := envs[0]
+		if len(envs) > 1 && !envSet(envs[:1]) && envSet(envs[1:]) {
+			env = envs[1]
+		}
+		v.BindEnv(s.key, env)
+
+		flags.String(s.key, "", "overrides "+s.key+" and "+envs[0])
+		v.BindPFlag(s.key, flags.Lookup(s.key))
+	}
+}
+
+// sources tells where the effective value of every setting came from, file holds only the
+// config file values
+func sources(file *viper.Viper, flags *pflag.FlagSet) map[string]Source {
+	sources := make(map[string]Source, len(settings))
+	for _, s := range settings {
+		sources[s.key] = SourceDefault
+
+		switch {
+		case flags.Changed(s.key):
+			sources[s.key] = SourceFlag
+		case envSet(s.envs()):
+			sources[s.key] = SourceEnv
+		case file.IsSet(s.key):
+			sources[s.key] = SourceFile
+		}
+	}
+	return sources
+}
+
+// values reads the effective value of every setting
+func values(v *viper.Viper) map[string]interface{} {
+	values := make(map[string]interface{}, len(settings))
+	for _, s := range settings {
+		values[s.key] = s.value(v)
+	}
+	return values
+}
+
+// value reads the effective value of s typed as its default, so equal values read from
+// different sources compare equal
+func (s setting) value(v *viper.Viper) interface{} {
+	switch s.defaultValue.(type) {
+	case string:
+		return v.GetString(s.key)
+	case int:
+		return v.GetInt(s.key)
+	case float64:
+		return v.GetFloat64(s.key)
+	case bool:
+		return v.GetBool(s.key)
+	case time.Duration:
+		return v.GetDuration(s.key)
+	case []string:
+		return splitList(v.GetStringSlice(s.key))
+	}
+	return v.Get(s.key)
+}
+
+// checkTypes reports the values that can't be read as the type of their default, viper
+// reads them as the zero value otherwise
+func checkTypes(v *viper.Viper, vd *validation) {
+	for _, s := range settings {
+		raw := v.Get(s.key)
+
+		var err error
+		switch s.defaultValue.(type) {
+		case int:
+			_, err = cast.ToIntE(raw)
+		case float64:
+			_, err = cast.ToFloat64E(raw)
+		case bool:
+			_, err = cast.ToBoolE(raw)
+		case time.Duration:
+			_, err = cast.ToDurationE(raw)
+		case []string:
+			_, err = cast.ToStringSliceE(raw)
+		}
+
+		if err != nil {
+			vd.add(s.key, errInvalidValue, "%v is not a valid %T", raw, s.defaultValue)
+		}
+	}
+}
+
+// Value is the effective value of a config key and where it came from
+type Value struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source Source      `json:"source"`
+	// Env var overriding the key, empty for the keys only read from the config file
+	Env string `json:"env,omitempty"`
+}
+
+// Redacted replaces the secret values set
+const Redacted = "<redacted>"
+
+// Values lists the effective value of every config key in settings order, the secrets set
+// are redacted
+func (c Config) Values() []Value {
+	values := make([]Value, 0, len(settings))
+	for _, s := range settings {
+		value := Value{Key: s.key, Value: c.values[s.key], Source: c.Sources[s.key]}
+		if envs := s.envs(); len(envs) > 0 {
+			value.Env = envs[0]
+		}
+		if s.secret && len(fmt.Sprint(value.Value)) > 0 {
+			value.Value = Redacted
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// Changes lists the keys whose effective value differs from prev to next, split in the
+// ones config reloads apply live and the ones that need a restart
+func Changes(prev, next Config) (live, restart []string) {
+	for _, s := range settings {
+		if reflect.DeepEqual(prev.values[s.key], next.values[s.key]) {
+			continue
+		}
+
+		if s.live {
+			live = append(live, s.key)
+		} else {
+			restart = append(restart, s.key)
+		}
+	}
+	return live, restart
+}
+
+// envSet tells if any of envs is set, viper skips empty env vars
+func envSet(envs []string) bool {
+	for _, env := range envs {
+		if len(os.Getenv(env)) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Problem found validating the config
+type Problem struct {
+	// Key of the config value, empty for problems of the whole config
+	Key string
+	Err error
+	// Detail of what is wrong with the value
+	Detail string
+}
+
+func (p Problem) String() string {
+	if len(p.Key) == 0 {
+		return fmt.Sprintf("%s: %s", p.Err, p.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Key, p.Err, p.Detail)
+}
+
+// validation collects every problem found reading the config, only the first problem of a
+// key is kept so an invalid value doesn't fail every check after it
+type validation struct {
+	problems []Problem
+	keys     map[string]bool
+}
+
+func (vd *validation) add(key string, err error, format string, args ...interface{}) {
+	if len(key) > 0 {
+		if vd.keys[key] {
+			return
+		}
+		if vd.keys == nil {
+			vd.keys = make(map[string]bool)
+		}
+		vd.keys[key] = true
+	}
+
+	vd.problems = append(vd.problems, Problem{Key: key, Err: err, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Validate reads the config like Read and reports every problem found at once, warnings are
+// the config file keys no setting reads, Read accepts them so they don't make it invalid
+func Validate(args []string) (conf Config, problems []Problem, warnings []Problem) {
+	conf, warnings, problems = load(args)
+	return conf, problems, warnings
+}
+
+// unknownKeys reports the keys of the config file no setting reads, they are usually typos
+func unknownKeys(file *viper.Viper) []Problem {
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.key] = true
+	}
+
+	vd := &validation{}
+	for _, key := range file.AllKeys() {
+		if known[key] || underFileOnly(key) {
+			continue
+		}
+		vd.add(key, errUnknownKey, "not read by any setting")
+	}
+	return vd.problems
+}
+
+// underFileOnly tells if key is nested in a map read as a whole from the config file
+func underFileOnly(key string) bool {
+	for _, s := range settings {
+		if s.fileOnly && strings.HasPrefix(key, s.key+".") {
+			return true
+		}
+	}
+	return false
+}
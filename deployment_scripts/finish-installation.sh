@@ -7,5 +7,10 @@ echo "Deployment finished at: "$DEPLOYMENT_TIME" UTC" > /home/ec2-user/apps/ws-m
 sudo chown -Rv ec2-user:ec2-user /home/ec2-user/apps/ws-message-dispatcher
 sudo chmod -Rv 775 /home/ec2-user/apps/ws-message-dispatcher
 
+## Validate the config before starting, every problem is printed and the deployment fails
+cd /home/ec2-user/apps/ws-message-dispatcher
+source /home/ec2-user/.bashrc
+./ws-message-dispatcher config validate || exit 1
+
 sudo systemctl start dispatcher.service
 sudo service nginx restart
\ No newline at end of file
@@ -3,11 +3,15 @@ module github.com/boletia/ws-message-dispatcher
 go 1.14
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/aws/aws-sdk-go v1.30.15
+	github.com/go-redis/redis/v7 v7.4.0
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/labstack/gommon v0.3.0 // indirect
 	github.com/sevenNt/echo-pprof v0.1.0
 	github.com/sirupsen/logrus v1.5.0
+	github.com/spf13/cast v1.3.0
+	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.6.3
 	github.com/stretchr/testify v1.5.1
 )
@@ -0,0 +1,244 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// State circuit breaker state
+type State int
+
+const (
+	// StateClosed lets every call through
+	StateClosed State = iota
+	// StateOpen rejects every call until the open timeout expires
+	StateOpen
+	// StateHalfOpen lets a limited number of trial calls through
+	StateHalfOpen
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+var (
+	// ErrOpen is returned when the breaker rejects a call
+	ErrOpen = errors.New("circuit breaker is open")
+
+	stateNames = map[State]string{
+		StateClosed:   "closed",
+		StateOpen:     "open",
+		StateHalfOpen: "half-open",
+	}
+)
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+// Settings holds breaker thresholds, zero values are replaced by defaults
+type Settings struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+}
+
+// Status breaker state snapshot
+type Status struct {
+	Target   string    `json:"target"`
+	State    string    `json:"state"`
+	Failures int       `json:"consecutive_failures"`
+	Since    time.Time `json:"since"`
+}
+
+type breaker struct {
+	mu       sync.Mutex
+	target   string
+	settings Settings
+	state    State
+	failures int
+	inFlight int
+	since    time.Time
+}
+
+// Set keeps one breaker per downstream target
+type Set struct {
+	mu       sync.Mutex
+	settings Settings
+	breakers map[string]*breaker
+}
+
+// New creates new breaker set
+func New(settings Settings) *Set {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = defaultFailureThreshold
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = defaultOpenTimeout
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = defaultHalfOpenRequests
+	}
+
+	return &Set{
+		settings: settings,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// Do runs fn through the target breaker, returns ErrOpen without calling fn when the breaker is open
+func (s *Set) Do(target string, fn func() error) error {
+	return s.DoContext(context.Background(), target, fn)
+}
+
+// DoContext runs fn like Do, fn failing once ctx is done is the caller giving up so it isn't
+// counted against target
+func (s *Set) DoContext(ctx context.Context, target string, fn func() error) error {
+	b := s.get(target)
+
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+	b.done(err)
+
+	return err
+}
+
+// Statuses returns the state of every known target sorted by target
+func (s *Set) Statuses() []Status {
+	s.mu.Lock()
+	breakers := make([]*breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.status())
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Target < statuses[j].Target
+	})
+
+	return statuses
+}
+
+func (s *Set) get(target string) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, exists := s.breakers[target]
+	if !exists {
+		b = &breaker{
+			target:   target,
+			settings: s.settings,
+			state:    StateClosed,
+			since:    time.Now(),
+		}
+		s.breakers[target] = b
+	}
+
+	return b
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if time.Since(b.since) < b.settings.OpenTimeout {
+			return ErrOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+
+	if b.state == StateHalfOpen {
+		if b.inFlight >= b.settings.HalfOpenRequests {
+			return ErrOpen
+		}
+		b.inFlight++
+	}
+
+	return nil
+}
+
+func (b *breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		if err == nil {
+			b.failures = 0
+			return
+		}
+
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.setState(StateOpen)
+		}
+
+	case StateHalfOpen:
+		if b.inFlight > 0 {
+			b.inFlight--
+		}
+		if err != nil {
+			b.failures++
+			b.setState(StateOpen)
+			return
+		}
+
+		b.failures = 0
+		b.setState(StateClosed)
+	}
+}
+
+// release ends a call without counting its result
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen && b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+func (b *breaker) setState(state State) {
+	log.WithFields(log.Fields{
+		"target":   b.target,
+		"from":     b.state,
+		"to":       state,
+		"failures": b.failures,
+	}).Warn("circuit breaker state changed")
+
+	b.state = state
+	b.since = time.Now()
+	b.inFlight = 0
+}
+
+func (b *breaker) status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return Status{
+		Target:   b.target,
+		State:    b.state.String(),
+		Failures: b.failures,
+		Since:    b.since,
+	}
+}
@@ -0,0 +1,69 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errDownstream = errors.New("downstream failure")
+
+func TestBreakerTransitions(t *testing.T) {
+	set := New(Settings{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 1,
+	})
+	failing := func() error { return errDownstream }
+	working := func() error { return nil }
+
+	assert.Equal(t, errDownstream, set.Do("lambda", failing))
+	assert.Equal(t, StateClosed.String(), set.Statuses()[0].State)
+
+	assert.Equal(t, errDownstream, set.Do("lambda", failing))
+	assert.Equal(t, StateOpen.String(), set.Statuses()[0].State)
+
+	calls := 0
+	assert.Equal(t, ErrOpen, set.Do("lambda", func() error { calls++; return nil }))
+	assert.Equal(t, 0, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, errDownstream, set.Do("lambda", failing))
+	assert.Equal(t, StateOpen.String(), set.Statuses()[0].State)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, set.Do("lambda", working))
+	assert.Equal(t, StateClosed.String(), set.Statuses()[0].State)
+	assert.Equal(t, 0, set.Statuses()[0].Failures)
+}
+
+func TestBreakerTargetsAreIndependent(t *testing.T) {
+	set := New(Settings{FailureThreshold: 1})
+
+	assert.Equal(t, errDownstream, set.Do("10.0.0.1:8080", func() error { return errDownstream }))
+	assert.NoError(t, set.Do("10.0.0.2:8080", func() error { return nil }))
+
+	statuses := set.Statuses()
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "10.0.0.1:8080", statuses[0].Target)
+		assert.Equal(t, StateOpen.String(), statuses[0].State)
+		assert.Equal(t, "10.0.0.2:8080", statuses[1].Target)
+		assert.Equal(t, StateClosed.String(), statuses[1].State)
+	}
+}
+
+func TestBreakerIgnoresCallerGivingUp(t *testing.T) {
+	set := New(Settings{FailureThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, set.DoContext(ctx, "lambda", func() error { return context.Canceled }))
+	assert.Equal(t, StateClosed.String(), set.Statuses()[0].State)
+	assert.Equal(t, 0, set.Statuses()[0].Failures)
+
+	assert.Equal(t, errDownstream, set.DoContext(context.Background(), "lambda", func() error { return errDownstream }))
+	assert.Equal(t, StateOpen.String(), set.Statuses()[0].State)
+}
@@ -0,0 +1,240 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultReloadInterval = time.Minute
+
+var (
+	errInvalidCA          = errors.New("no certificates found in ca file")
+	errIncompleteKeyPair  = errors.New("cert file and key file must be set together")
+	errMissingCertificate = errors.New("client certificate not loaded")
+)
+
+// Settings holds the files used for TLS connections, zero values are replaced by defaults
+type Settings struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name verified on server certificates, the dialed host is used when empty
+	ServerName         string
+	InsecureSkipVerify bool
+	ReloadInterval     time.Duration
+}
+
+// Reloader keeps the CA pool and client certificate up to date with the files on disk
+type Reloader struct {
+	settings Settings
+
+	mu       sync.RWMutex
+	pool     *x509.CertPool
+	cert     *tls.Certificate
+	modTimes map[string]time.Time
+
+	stop chan struct{}
+}
+
+// New loads the configured files, it fails when any of them is invalid
+func New(settings Settings) (*Reloader, error) {
+	if settings.ReloadInterval <= 0 {
+		settings.ReloadInterval = defaultReloadInterval
+	}
+
+	if (len(settings.CertFile) == 0) != (len(settings.KeyFile) == 0) {
+		return nil, errIncompleteKeyPair
+	}
+
+	r := &Reloader{
+		settings: settings,
+		modTimes: make(map[string]time.Time),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again, the previous certificates are kept when they are invalid
+func (r *Reloader) Reload() error {
+	var pool *x509.CertPool
+	var cert *tls.Certificate
+
+	if len(r.settings.CAFile) > 0 {
+		caPEM, err := ioutil.ReadFile(r.settings.CAFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return errInvalidCA
+		}
+	}
+
+	if len(r.settings.CertFile) > 0 {
+		pair, err := tls.LoadX509KeyPair(r.settings.CertFile, r.settings.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+
+	modTimes := r.currentModTimes()
+
+	r.mu.Lock()
+	r.pool = pool
+	r.cert = cert
+	r.modTimes = modTimes
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Start reloads the files in background whenever they change until Stop is called
+func (r *Reloader) Start() {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(r.settings.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+
+				if err := r.Reload(); err != nil {
+					log.WithFields(log.Fields{
+						"error":     err,
+						"ca_file":   r.settings.CAFile,
+						"cert_file": r.settings.CertFile,
+					}).Error("unable to reload certificates, keeping previous ones")
+					continue
+				}
+
+				log.WithFields(log.Fields{
+					"ca_file":   r.settings.CAFile,
+					"cert_file": r.settings.CertFile,
+				}).Info("certificates reloaded")
+			}
+		}
+	}()
+}
+
+// Stop stops background reloading
+func (r *Reloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// ClientConfig returns a TLS config for serverName built from the current certificates
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.settings.ServerName) > 0 {
+		serverName = r.settings.ServerName
+	}
+
+	config := &tls.Config{
+		RootCAs:            r.pool,
+		ServerName:         serverName,
+		InsecureSkipVerify: r.settings.InsecureSkipVerify,
+	}
+
+	if len(r.settings.CertFile) > 0 {
+		cert := r.cert
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert == nil {
+				return nil, errMissingCertificate
+			}
+			return cert, nil
+		}
+	}
+
+	return config
+}
+
+// DialTLSContext dials addr with dialer and performs the TLS handshake with the current certificates
+func (r *Reloader) DialTLSContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		rawConn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			rawConn.SetDeadline(deadline)
+		}
+
+		conn := tls.Client(rawConn, r.ClientConfig(host))
+		if err = conn.Handshake(); err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+
+		rawConn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+func (r *Reloader) changed() bool {
+	current := r.currentModTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for file, modTime := range current {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) currentModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time, 3)
+	for _, file := range []string{r.settings.CAFile, r.settings.CertFile, r.settings.KeyFile} {
+		if len(file) == 0 {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
@@ -0,0 +1,158 @@
+package eventconfig
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultRefreshInterval = 30 * time.Second
+
+type configGetter interface {
+	GetEventConfigs(ctx context.Context, configs map[string]store.EventConfig) error
+}
+
+// Status event configs snapshot description
+type Status struct {
+	Events      map[string]store.EventConfig `json:"events"`
+	RefreshedAt time.Time                    `json:"refreshed_at"`
+	LastError   string                       `json:"last_error,omitempty"`
+}
+
+// Cache serves event dispatch settings from an in-memory snapshot refreshed in background
+type Cache struct {
+	getter   configGetter
+	interval time.Duration
+
+	mu          sync.RWMutex
+	current     map[string]store.EventConfig
+	refreshedAt time.Time
+	lastError   string
+
+	notify chan struct{}
+	stop   chan struct{}
+}
+
+// New creates new event configs cache
+func New(getter configGetter, interval time.Duration) *Cache {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	return &Cache{
+		getter:   getter,
+		interval: interval,
+		current:  make(map[string]store.EventConfig),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Load replaces the snapshot with a fresh copy of the event configs, the last good
+// snapshot is kept when it fails
+func (c *Cache) Load(ctx context.Context) error {
+	next := make(map[string]store.EventConfig)
+	err := c.getter.GetEventConfigs(ctx, next)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.lastError = err.Error()
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to refresh event configs, serving last snapshot")
+		return err
+	}
+
+	c.current = next
+	c.refreshedAt = time.Now()
+	c.lastError = ""
+
+	log.WithFields(log.Fields{"events": len(next)}).Info("event configs refreshed")
+
+	return nil
+}
+
+// Refresh asks the background loop to reload the snapshot as soon as possible
+func (c *Cache) Refresh() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start refreshes the snapshot in background until Stop is called
+func (c *Cache) Start() {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.stop = make(chan struct{})
+	stop := c.stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c.loadWithTimeout()
+			case <-c.notify:
+				c.loadWithTimeout()
+			}
+		}
+	}()
+}
+
+func (c *Cache) loadWithTimeout() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	c.Load(ctx)
+}
+
+// Stop stops background refresh
+func (c *Cache) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Get gets the settings of subdomain, false when the event is not configured
+func (c *Cache) Get(subdomain string) (store.EventConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	config, exists := c.current[subdomain]
+	return config, exists
+}
+
+// Status returns the current snapshot
+func (c *Cache) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := Status{
+		Events:      make(map[string]store.EventConfig, len(c.current)),
+		RefreshedAt: c.refreshedAt,
+		LastError:   c.lastError,
+	}
+
+	for subdomain, config := range c.current {
+		status.Events[subdomain] = config
+	}
+
+	return status
+}
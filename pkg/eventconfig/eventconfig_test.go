@@ -0,0 +1,64 @@
+package eventconfig
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type configGetterMock struct {
+	configs map[string]store.EventConfig
+	err     error
+}
+
+func (cg *configGetterMock) GetEventConfigs(ctx context.Context, configs map[string]store.EventConfig) error {
+	if cg.err != nil {
+		return cg.err
+	}
+	for subdomain, config := range cg.configs {
+		configs[subdomain] = config
+	}
+	return nil
+}
+
+func TestCacheKeepsLastSnapshot(t *testing.T) {
+	getter := &configGetterMock{configs: map[string]store.EventConfig{
+		"el-show-de-producto-online": {EventSubdomain: "el-show-de-producto-online", Paused: true},
+	}}
+	cache := New(getter, time.Minute)
+
+	_, exists := cache.Get("el-show-de-producto-online")
+	assert.False(t, exists)
+
+	assert.NoError(t, cache.Load(context.Background()))
+	config, exists := cache.Get("el-show-de-producto-online")
+	assert.True(t, exists)
+	assert.True(t, config.Paused)
+
+	getter.err = errors.New("table not found")
+	assert.Error(t, cache.Load(context.Background()))
+
+	config, exists = cache.Get("el-show-de-producto-online")
+	assert.True(t, exists)
+	assert.True(t, config.Paused)
+	assert.Equal(t, "table not found", cache.Status().LastError)
+}
+
+func TestCacheRefresh(t *testing.T) {
+	getter := &configGetterMock{configs: map[string]store.EventConfig{}}
+	cache := New(getter, time.Hour)
+	cache.Start()
+	defer cache.Stop()
+
+	getter.configs = map[string]store.EventConfig{"otro-evento": {EventSubdomain: "otro-evento", Muted: true}}
+	cache.Refresh()
+
+	assert.Eventually(t, func() bool {
+		_, exists := cache.Get("otro-evento")
+		return exists
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,283 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultUnhealthyAfter = 3
+	defaultProbeInterval  = 5 * time.Second
+	defaultProbeTimeout   = time.Second
+	defaultLatencyWeight  = 0.2
+)
+
+// Settings holds health tracking thresholds, zero values are replaced by defaults
+type Settings struct {
+	UnhealthyAfter int
+	ProbeInterval  time.Duration
+	ProbeTimeout   time.Duration
+	// ProbePath is requested with GET on unhealthy servers, a plain tcp dial is used when empty
+	ProbePath     string
+	LatencyWeight float64
+}
+
+// Status server health snapshot
+type Status struct {
+	Target              string    `json:"target"`
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LatencyEWMA         string    `json:"latency_ewma"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSeen            time.Time `json:"last_seen"`
+}
+
+type server struct {
+	healthy             bool
+	consecutiveFailures int
+	latency             float64
+	lastError           string
+	lastSeen            time.Time
+	// scheme and client of the probes, plain http when unset
+	scheme string
+	client *http.Client
+}
+
+// endpoint of an unhealthy server to probe
+type endpoint struct {
+	target string
+	scheme string
+	client *http.Client
+}
+
+// Tracker keeps health state per downstream server
+type Tracker struct {
+	mu       sync.RWMutex
+	settings Settings
+	client   *http.Client
+	servers  map[string]*server
+	stop     chan struct{}
+}
+
+// New creates new health tracker
+func New(settings Settings) *Tracker {
+	if settings.UnhealthyAfter <= 0 {
+		settings.UnhealthyAfter = defaultUnhealthyAfter
+	}
+	if settings.ProbeInterval <= 0 {
+		settings.ProbeInterval = defaultProbeInterval
+	}
+	if settings.ProbeTimeout <= 0 {
+		settings.ProbeTimeout = defaultProbeTimeout
+	}
+	if settings.LatencyWeight <= 0 || settings.LatencyWeight > 1 {
+		settings.LatencyWeight = defaultLatencyWeight
+	}
+
+	return &Tracker{
+		settings: settings,
+		client:   &http.Client{Timeout: settings.ProbeTimeout},
+		servers:  make(map[string]*server),
+	}
+}
+
+// Record stores the outcome of a delivery to target
+func (t *Tracker) Record(target string, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	srv := t.get(target)
+	srv.lastSeen = time.Now()
+
+	if srv.latency == 0 {
+		srv.latency = float64(latency)
+	} else {
+		srv.latency = t.settings.LatencyWeight*float64(latency) + (1-t.settings.LatencyWeight)*srv.latency
+	}
+
+	if err == nil {
+		t.markSuccess(target, srv)
+		return
+	}
+
+	srv.consecutiveFailures++
+	srv.lastError = err.Error()
+	if srv.healthy && srv.consecutiveFailures >= t.settings.UnhealthyAfter {
+		srv.healthy = false
+		log.WithFields(log.Fields{
+			"server":   target,
+			"failures": srv.consecutiveFailures,
+			"error":    err,
+		}).Warn("chat server marked unhealthy")
+	}
+}
+
+// Healthy reports whether target should receive messages, unknown targets are healthy
+func (t *Tracker) Healthy(target string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	srv, exists := t.servers[target]
+	return !exists || srv.healthy
+}
+
+// Statuses returns the health of every known server sorted by target
+func (t *Tracker) Statuses() []Status {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(t.servers))
+	for target, srv := range t.servers {
+		statuses = append(statuses, Status{
+			Target:              target,
+			Healthy:             srv.healthy,
+			ConsecutiveFailures: srv.consecutiveFailures,
+			LatencyEWMA:         time.Duration(srv.latency).String(),
+			LastError:           srv.lastError,
+			LastSeen:            srv.lastSeen,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Target < statuses[j].Target
+	})
+
+	return statuses
+}
+
+// Start probes unhealthy servers in background until Stop is called
+func (t *Tracker) Start() {
+	t.mu.Lock()
+	if t.stop != nil {
+		t.mu.Unlock()
+		return
+	}
+	t.stop = make(chan struct{})
+	stop := t.stop
+	t.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(t.settings.ProbeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				t.probeUnhealthy()
+			}
+		}
+	}()
+}
+
+// Stop stops background probing
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// Endpoint sets the scheme and client target is probed with, tls servers are probed with
+// the client they are sent messages with
+func (t *Tracker) Endpoint(target string, scheme string, client *http.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	srv := t.get(target)
+	srv.scheme = scheme
+	srv.client = client
+}
+
+func (t *Tracker) probeUnhealthy() {
+	t.mu.RLock()
+	endpoints := make([]endpoint, 0)
+	for target, srv := range t.servers {
+		if !srv.healthy {
+			endpoints = append(endpoints, endpoint{target: target, scheme: srv.scheme, client: srv.client})
+		}
+	}
+	t.mu.RUnlock()
+
+	for _, e := range endpoints {
+		err := t.probe(e)
+
+		t.mu.Lock()
+		srv := t.get(e.target)
+		if err == nil {
+			t.markSuccess(e.target, srv)
+		} else {
+			srv.lastError = err.Error()
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *Tracker) probe(e endpoint) error {
+	if len(t.settings.ProbePath) == 0 {
+		conn, err := net.DialTimeout("tcp", e.target, t.settings.ProbeTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	scheme, client := e.scheme, e.client
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	if client == nil {
+		client = t.client
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.settings.ProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s%s", scheme, e.target, t.settings.ProbePath), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("probe responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *Tracker) markSuccess(target string, srv *server) {
+	if !srv.healthy {
+		log.WithFields(log.Fields{
+			"server": target,
+		}).Info("chat server recovered")
+	}
+
+	srv.healthy = true
+	srv.consecutiveFailures = 0
+	srv.lastError = ""
+}
+
+func (t *Tracker) get(target string) *server {
+	srv, exists := t.servers[target]
+	if !exists {
+		srv = &server{healthy: true}
+		t.servers[target] = srv
+	}
+	return srv
+}
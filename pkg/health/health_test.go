@@ -0,0 +1,68 @@
+package health
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerExcludesAndRecovers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	target := listener.Addr().String()
+
+	tracker := New(Settings{
+		UnhealthyAfter: 2,
+		ProbeInterval:  10 * time.Millisecond,
+	})
+
+	assert.True(t, tracker.Healthy(target))
+
+	tracker.Record(target, time.Second, errors.New("timeout"))
+	assert.True(t, tracker.Healthy(target))
+
+	tracker.Record(target, time.Second, errors.New("timeout"))
+	assert.False(t, tracker.Healthy(target))
+	assert.Equal(t, 2, tracker.Statuses()[0].ConsecutiveFailures)
+
+	tracker.Start()
+	defer tracker.Stop()
+
+	assert.Eventually(t, func() bool {
+		return tracker.Healthy(target)
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, tracker.Statuses()[0].ConsecutiveFailures)
+}
+
+func TestTrackerProbesTLSEndpoint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/health", r.URL.Path)
+	}))
+	defer server.Close()
+	target := server.Listener.Addr().String()
+
+	tracker := New(Settings{
+		UnhealthyAfter: 1,
+		ProbeInterval:  10 * time.Millisecond,
+		ProbePath:      "/health",
+	})
+
+	tracker.Record(target, time.Second, errors.New("timeout"))
+	tracker.Endpoint(target, "https", server.Client())
+	assert.False(t, tracker.Healthy(target))
+
+	tracker.Start()
+	defer tracker.Stop()
+
+	assert.Eventually(t, func() bool {
+		return tracker.Healthy(target)
+	}, time.Second, 10*time.Millisecond)
+}
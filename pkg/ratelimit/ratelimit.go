@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval between sweeps of the buckets refilled up to their burst
+const pruneInterval = time.Minute
+
+// Limit token bucket settings, Rate tokens per second with Burst tokens of capacity
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// Set keeps one token bucket per key
+type Set struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	pruned  time.Time
+}
+
+// New creates new rate limiters set
+func New() *Set {
+	return &Set{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key, a changed limit restarts the bucket full and
+// a zero rate never limits
+func (s *Set) Allow(key string, limit Limit) bool {
+	if limit.Rate <= 0 {
+		return true
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.pruned) >= pruneInterval {
+		s.prune(now)
+	}
+
+	b, exists := s.buckets[key]
+	if !exists || b.limit != limit {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// prune drops the buckets idle long enough to be full again, a new bucket starts full too
+// so keys seen once don't stay forever
+func (s *Set) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.pruned = now
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Now()
+	set := New()
+	set.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, set.Allow("show", limit))
+	}
+	assert.False(t, set.Allow("show", limit))
+	assert.True(t, set.Allow("other-show", limit))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, set.Allow("show", limit))
+	assert.False(t, set.Allow("show", limit))
+
+	assert.True(t, set.Allow("show", Limit{}))
+	assert.True(t, set.Allow("show", Limit{Rate: 1, Burst: 1}))
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	set := New()
+	set.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	assert.True(t, set.Allow("show", limit))
+	assert.True(t, set.Allow("other-show", limit))
+	assert.True(t, set.Allow("other-show", limit))
+	assert.Len(t, set.buckets, 2)
+
+	// show refills in a second, other-show in two
+	set.prune(now.Add(1500 * time.Millisecond))
+	assert.Len(t, set.buckets, 1)
+
+	now = now.Add(pruneInterval + 2*time.Second)
+	assert.True(t, set.Allow("third-show", limit))
+	assert.Len(t, set.buckets, 1)
+	assert.NotContains(t, set.buckets, "other-show")
+}
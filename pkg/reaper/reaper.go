@@ -0,0 +1,314 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultInterval  = time.Hour
+	defaultBatchSize = 25
+)
+
+var (
+	errRunning    = errors.New("connection reaper is already running")
+	reaperMetrics = expvar.NewMap("connection_reaper")
+)
+
+type connectionStore interface {
+	StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []store.Connection) error
+	DeleteConnections(ctx context.Context, connections []store.Connection) (int, error)
+}
+
+// Settings of the stale connections reaper
+type Settings struct {
+	// MaxAge of connections, older ones are reaped; only gone connections are when zero
+	MaxAge time.Duration
+	// Interval between runs
+	Interval time.Duration
+	// BatchSize connections deleted per store request
+	BatchSize int
+	// Rate of deleted connections per second, unlimited when zero
+	Rate float64
+	// DryRun reports stale connections without deleting them
+	DryRun bool
+}
+
+// Report summary of a reaper run
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	// Found stale connections, Gone and Expired tell why they are stale
+	Found   int `json:"found"`
+	Gone    int `json:"gone"`
+	Expired int `json:"expired"`
+	Deleted int `json:"deleted"`
+	Batches int `json:"batches"`
+	// Events stale connections per event subdomain
+	Events map[string]int `json:"events"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Status reaper settings and runs summary
+type Status struct {
+	MaxAge       string  `json:"max_age"`
+	Interval     string  `json:"interval"`
+	DryRun       bool    `json:"dry_run"`
+	Running      bool    `json:"running"`
+	Runs         int     `json:"runs"`
+	TotalDeleted int     `json:"total_deleted"`
+	LastRun      *Report `json:"last_run,omitempty"`
+}
+
+// Reaper deletes the connections the connector missed the disconnect of in background
+type Reaper struct {
+	store    connectionStore
+	settings Settings
+	now      func() time.Time
+
+	mu           sync.Mutex
+	running      bool
+	runs         int
+	totalDeleted int
+	last         *Report
+
+	notify chan struct{}
+	stop   chan struct{}
+}
+
+// New creates new stale connections reaper
+func New(connections connectionStore, settings Settings) *Reaper {
+	if settings.Interval <= 0 {
+		settings.Interval = defaultInterval
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = defaultBatchSize
+	}
+
+	return &Reaper{
+		store:    connections,
+		settings: settings,
+		now:      time.Now,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Run finds the stale connections and deletes them in batches paced to the configured rate,
+// the scan stops at the first failed batch
+func (r *Reaper) Run(ctx context.Context) (Report, error) {
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return Report{}, errRunning
+	}
+	r.running = true
+	r.mu.Unlock()
+
+	report := Report{
+		StartedAt: r.now(),
+		DryRun:    r.settings.DryRun,
+		Events:    make(map[string]int),
+	}
+
+	var connectedBefore time.Time
+	if r.settings.MaxAge > 0 {
+		connectedBefore = report.StartedAt.Add(-r.settings.MaxAge)
+	}
+
+	err := r.reap(ctx, connectedBefore, &report)
+	report.FinishedAt = r.now()
+	if err != nil {
+		report.Error = err.Error()
+		reaperMetrics.Add("errors", 1)
+	}
+
+	r.mu.Lock()
+	r.running = false
+	r.runs++
+	r.totalDeleted += report.Deleted
+	r.last = &report
+	r.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"found":   report.Found,
+		"gone":    report.Gone,
+		"expired": report.Expired,
+		"deleted": report.Deleted,
+		"dry_run": report.DryRun,
+		"elapse":  report.FinishedAt.Sub(report.StartedAt).String(),
+		"error":   report.Error,
+	}).Info("stale connections reaped")
+
+	return report, err
+}
+
+func (r *Reaper) reap(ctx context.Context, connectedBefore time.Time, report *Report) error {
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	defer cancelScan()
+
+	pages := make(chan []store.Connection)
+	scanErr := make(chan error, 1)
+
+	go func() {
+		scanErr <- r.store.StreamStaleConnections(scanCtx, connectedBefore, pages)
+		close(pages)
+	}()
+
+	var err error
+	batch := make([]store.Connection, 0, r.settings.BatchSize)
+
+	flush := func() {
+		if err != nil || len(batch) == 0 {
+			return
+		}
+
+		report.Batches++
+		if !r.settings.DryRun {
+			deleted, deleteErr := r.store.DeleteConnections(ctx, batch)
+			report.Deleted += deleted
+			reaperMetrics.Add("deleted", int64(deleted))
+
+			if err = deleteErr; err == nil {
+				err = r.pace(ctx, len(batch))
+			}
+			if err != nil {
+				cancelScan()
+			}
+		}
+
+		batch = make([]store.Connection, 0, r.settings.BatchSize)
+	}
+
+	// pages are drained after a failure so the scan can return
+	for page := range pages {
+		for _, conn := range page {
+			if err != nil {
+				break
+			}
+
+			report.Found++
+			report.Events[conn.EventSubdomain]++
+			if conn.Gone {
+				report.Gone++
+			} else {
+				report.Expired++
+			}
+			reaperMetrics.Add("found", 1)
+
+			batch = append(batch, conn)
+			if len(batch) == r.settings.BatchSize {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	if streamErr := <-scanErr; err == nil {
+		err = streamErr
+	}
+	return err
+}
+
+// pace waits the time deleting deleted connections takes at the configured rate
+func (r *Reaper) pace(ctx context.Context, deleted int) error {
+	if r.settings.Rate <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(float64(deleted) / r.settings.Rate * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Trigger asks the background loop to run as soon as possible
+func (r *Reaper) Trigger() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the reaper in background every interval until Stop is called
+func (r *Reaper) Start() {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(r.settings.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.Run(ctx)
+			case <-r.notify:
+				r.Run(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops background runs, a run in progress is cancelled
+func (r *Reaper) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Status returns the reaper settings and the report of the last run
+func (r *Reaper) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := Status{
+		MaxAge:       r.settings.MaxAge.String(),
+		Interval:     r.settings.Interval.String(),
+		DryRun:       r.settings.DryRun,
+		Running:      r.running,
+		Runs:         r.runs,
+		TotalDeleted: r.totalDeleted,
+	}
+
+	if r.last != nil {
+		last := *r.last
+		last.Events = make(map[string]int, len(r.last.Events))
+		for subdomain, found := range r.last.Events {
+			last.Events[subdomain] = found
+		}
+		status.LastRun = &last
+	}
+
+	return status
+}
@@ -0,0 +1,118 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type staleStore struct {
+	pages     [][]store.Connection
+	deleteErr error
+
+	mu              sync.Mutex
+	connectedBefore time.Time
+	batches         [][]string
+}
+
+func (ss *staleStore) StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []store.Connection) error {
+	ss.mu.Lock()
+	ss.connectedBefore = connectedBefore
+	ss.mu.Unlock()
+
+	for _, page := range ss.pages {
+		select {
+		case pages <- page:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (ss *staleStore) DeleteConnections(ctx context.Context, connections []store.Connection) (int, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.deleteErr != nil {
+		return 0, ss.deleteErr
+	}
+	ss.batches = append(ss.batches, store.ConnectionIDs(connections))
+	return len(connections), nil
+}
+
+var stalePages = [][]store.Connection{
+	{
+		{ConnectionID: "conn-1", EventSubdomain: "show", Gone: true},
+		{ConnectionID: "conn-2", EventSubdomain: "show"},
+		{ConnectionID: "conn-3", EventSubdomain: "show"},
+		{ConnectionID: "conn-4", EventSubdomain: "other"},
+	},
+	{
+		{ConnectionID: "conn-5", EventSubdomain: "other", Gone: true},
+	},
+}
+
+func TestReaperDeletesInBatches(t *testing.T) {
+	now := time.Date(2020, 10, 1, 20, 0, 0, 0, time.UTC)
+	connections := &staleStore{pages: stalePages}
+	reaper := New(connections, Settings{MaxAge: 24 * time.Hour, BatchSize: 2})
+	reaper.now = func() time.Time { return now }
+
+	report, err := reaper.Run(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, now.Add(-24*time.Hour), connections.connectedBefore)
+	assert.Equal(t, [][]string{{"conn-1", "conn-2"}, {"conn-3", "conn-4"}, {"conn-5"}}, connections.batches)
+	assert.Equal(t, 5, report.Found)
+	assert.Equal(t, 2, report.Gone)
+	assert.Equal(t, 3, report.Expired)
+	assert.Equal(t, 5, report.Deleted)
+	assert.Equal(t, 3, report.Batches)
+	assert.Equal(t, map[string]int{"show": 3, "other": 2}, report.Events)
+
+	status := reaper.Status()
+	assert.Equal(t, 1, status.Runs)
+	assert.Equal(t, 5, status.TotalDeleted)
+	assert.Equal(t, &report, status.LastRun)
+}
+
+func TestReaperDryRun(t *testing.T) {
+	connections := &staleStore{pages: stalePages}
+	reaper := New(connections, Settings{DryRun: true})
+
+	report, err := reaper.Run(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 5, report.Found)
+	assert.Zero(t, report.Deleted)
+	assert.Empty(t, connections.batches)
+	// only gone connections are stale without max age
+	assert.True(t, connections.connectedBefore.IsZero())
+}
+
+func TestReaperStopsOnDeleteError(t *testing.T) {
+	failure := errors.New("provisioned throughput exceeded")
+	reaper := New(&staleStore{pages: stalePages, deleteErr: failure}, Settings{BatchSize: 1})
+
+	report, err := reaper.Run(context.Background())
+	assert.Equal(t, failure, err)
+	assert.Equal(t, failure.Error(), report.Error)
+	assert.Equal(t, 1, report.Batches)
+	assert.Equal(t, 1, report.Found)
+}
+
+func TestReaperRateLimit(t *testing.T) {
+	reaper := New(&staleStore{pages: stalePages}, Settings{BatchSize: 5, Rate: 100})
+
+	startTime := time.Now()
+	_, err := reaper.Run(context.Background())
+	assert.NoError(t, err)
+	// five connections at 100 per second
+	assert.True(t, time.Since(startTime) >= 50*time.Millisecond)
+}
@@ -0,0 +1,259 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultRefreshInterval = 30 * time.Second
+
+type serverGetter interface {
+	GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error)
+	GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error)
+}
+
+// Status registry snapshot description, servers are grouped by server type
+type Status struct {
+	Servers     map[string][]store.ChatServer            `json:"servers"`
+	Events      map[string]map[string][]store.ChatServer `json:"events"`
+	RefreshedAt time.Time                                `json:"refreshed_at"`
+	LastError   string                                   `json:"last_error,omitempty"`
+}
+
+type eventKey struct {
+	serverType string
+	subdomain  string
+}
+
+type snapshot struct {
+	servers map[string][]store.ChatServer
+	events  map[eventKey][]store.ChatServer
+}
+
+// Registry serves chat servers from an in-memory snapshot refreshed in background
+type Registry struct {
+	getter      serverGetter
+	serverTypes []string
+	interval    time.Duration
+
+	mu          sync.RWMutex
+	current     snapshot
+	requested   map[eventKey]bool
+	refreshedAt time.Time
+	lastError   string
+
+	notify chan struct{}
+	stop   chan struct{}
+}
+
+// New creates new registry for the servers of serverTypes
+func New(getter serverGetter, serverTypes []string, interval time.Duration) *Registry {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	return &Registry{
+		getter:      getter,
+		serverTypes: serverTypes,
+		interval:    interval,
+		current:     newSnapshot(),
+		requested:   make(map[eventKey]bool),
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+func newSnapshot() snapshot {
+	return snapshot{
+		servers: make(map[string][]store.ChatServer),
+		events:  make(map[eventKey][]store.ChatServer),
+	}
+}
+
+// Load replaces the snapshot with a fresh copy of the servers table, the servers of the
+// events requested since the last refresh are taken from the same scan. The last good
+// snapshot is kept when it fails
+func (r *Registry) Load(ctx context.Context) error {
+	r.mu.RLock()
+	events := make([]eventKey, 0, len(r.requested))
+	for key := range r.requested {
+		events = append(events, key)
+	}
+	r.mu.RUnlock()
+
+	serverTypes := append([]string(nil), r.serverTypes...)
+	scanned := make(map[string][]store.ChatServer, len(serverTypes))
+	for _, serverType := range serverTypes {
+		scanned[serverType] = nil
+	}
+	for _, key := range events {
+		if _, exists := scanned[key.serverType]; !exists {
+			scanned[key.serverType] = nil
+			serverTypes = append(serverTypes, key.serverType)
+		}
+	}
+
+	next := newSnapshot()
+	var err error
+
+	for idx := 0; idx < len(serverTypes) && err == nil; idx++ {
+		scanned[serverTypes[idx]], err = r.getter.GetServerConnections(ctx, serverTypes[idx])
+	}
+
+	if err == nil {
+		for _, serverType := range r.serverTypes {
+			next.servers[serverType] = scanned[serverType]
+		}
+		for _, key := range events {
+			next.events[key] = hosting(scanned[key.serverType], key.subdomain)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.lastError = err.Error()
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to refresh chat servers, serving last snapshot")
+		return err
+	}
+
+	r.current = next
+	r.requested = make(map[eventKey]bool)
+	r.refreshedAt = time.Now()
+	r.lastError = ""
+
+	log.WithFields(log.Fields{
+		"server_types": len(next.servers),
+		"events":       len(next.events),
+	}).Info("chat servers registry refreshed")
+
+	return nil
+}
+
+// hosting filters the servers registered as hosting subdomain
+func hosting(servers []store.ChatServer, subdomain string) []store.ChatServer {
+	hosts := make([]store.ChatServer, 0)
+	for _, server := range servers {
+		if server.Hosts(subdomain) {
+			hosts = append(hosts, server)
+		}
+	}
+	return hosts
+}
+
+// Refresh asks the background loop to reload the snapshot as soon as possible
+func (r *Registry) Refresh() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start refreshes the snapshot in background until Stop is called
+func (r *Registry) Start() {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.loadWithTimeout()
+			case <-r.notify:
+				r.loadWithTimeout()
+			}
+		}
+	}()
+}
+
+func (r *Registry) loadWithTimeout() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	r.Load(ctx)
+}
+
+// Stop stops background refresh
+func (r *Registry) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// GetServerConnections returns a copy of the snapshot servers of serverType
+func (r *Registry) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]store.ChatServer(nil), r.current.servers[serverType]...), nil
+}
+
+// GetEventServers returns a copy of the servers of serverType hosting subdomain, unknown
+// events are read from the store once and kept until the next refresh
+func (r *Registry) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	key := eventKey{serverType: serverType, subdomain: subdomain}
+
+	r.mu.Lock()
+	r.requested[key] = true
+	cached, exists := r.current.events[key]
+	r.mu.Unlock()
+
+	if !exists {
+		var err error
+		if cached, err = r.getter.GetEventServers(ctx, serverType, subdomain); err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		r.current.events[key] = cached
+		r.mu.Unlock()
+	}
+
+	return append([]store.ChatServer(nil), cached...), nil
+}
+
+// Status returns the current snapshot
+func (r *Registry) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status := Status{
+		Servers:     make(map[string][]store.ChatServer, len(r.current.servers)),
+		Events:      make(map[string]map[string][]store.ChatServer),
+		RefreshedAt: r.refreshedAt,
+		LastError:   r.lastError,
+	}
+
+	for serverType, servers := range r.current.servers {
+		status.Servers[serverType] = servers
+	}
+	for key, servers := range r.current.events {
+		if _, exists := status.Events[key.serverType]; !exists {
+			status.Events[key.serverType] = make(map[string][]store.ChatServer)
+		}
+		status.Events[key.serverType][key.subdomain] = servers
+	}
+
+	return status
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type serverStore struct {
+	servers    []store.ChatServer
+	events     map[string][]store.ChatServer
+	err        error
+	scans      int
+	eventLoads int
+}
+
+func (ss *serverStore) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	ss.scans++
+	if ss.err != nil {
+		return nil, ss.err
+	}
+	return append([]store.ChatServer(nil), ss.servers...), nil
+}
+
+func (ss *serverStore) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	ss.eventLoads++
+	if ss.err != nil {
+		return nil, ss.err
+	}
+	return append([]store.ChatServer(nil), ss.events[subdomain]...), nil
+}
+
+func TestRegistryServesSnapshot(t *testing.T) {
+	getter := &serverStore{
+		servers: []store.ChatServer{
+			{IP: "10.0.0.1", Port: 8080, ServerType: "chat"},
+			{IP: "10.0.0.2", Port: 8080, ServerType: "chat", Region: "us-east-1"},
+		},
+		events: map[string][]store.ChatServer{
+			"show": {{IP: "10.0.0.2", Port: 8080, ServerType: "chat", Region: "us-east-1"}},
+		},
+	}
+	reg := New(getter, []string{"chat"}, time.Minute)
+
+	assert.NoError(t, reg.Load(context.Background()))
+
+	for i := 0; i < 3; i++ {
+		servers, err := reg.GetServerConnections(context.Background(), "chat")
+		assert.NoError(t, err)
+		assert.Equal(t, getter.servers, servers)
+	}
+	assert.Equal(t, 1, getter.scans)
+
+	eventServers, err := reg.GetEventServers(context.Background(), "chat", "show")
+	assert.NoError(t, err)
+	assert.Equal(t, getter.events["show"], eventServers)
+
+	// callers get copies, the snapshot can't be changed through them
+	eventServers[0].Port = 9090
+	eventServers, _ = reg.GetEventServers(context.Background(), "chat", "show")
+	assert.Equal(t, 8080, eventServers[0].Port)
+}
+
+func TestRegistryKeepsLastGoodSnapshot(t *testing.T) {
+	getter := &serverStore{
+		servers: []store.ChatServer{{IP: "10.0.0.1", Port: 8080, ServerType: "chat"}},
+	}
+	reg := New(getter, []string{"chat"}, time.Minute)
+	assert.NoError(t, reg.Load(context.Background()))
+
+	getter.err = errors.New("throttled")
+	assert.Error(t, reg.Load(context.Background()))
+
+	servers, err := reg.GetServerConnections(context.Background(), "chat")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.ChatServer{{IP: "10.0.0.1", Port: 8080, ServerType: "chat"}}, servers)
+	assert.Equal(t, "throttled", reg.Status().LastError)
+}
+
+func TestRegistryIndexesEventsFromServersScan(t *testing.T) {
+	hosting := store.ChatServer{IP: "10.0.0.2", Port: 8080, ServerType: "chat", Events: []string{"show"}}
+	getter := &serverStore{
+		servers: []store.ChatServer{{IP: "10.0.0.1", Port: 8080, ServerType: "chat"}, hosting},
+		events:  map[string][]store.ChatServer{"show": {hosting}},
+	}
+	reg := New(getter, []string{"chat"}, time.Minute)
+
+	// unknown events are read once until the next refresh
+	_, err := reg.GetEventServers(context.Background(), "chat", "show")
+	assert.NoError(t, err)
+	_, err = reg.GetEventServers(context.Background(), "polls", "show")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, getter.eventLoads)
+
+	assert.NoError(t, reg.Load(context.Background()))
+	assert.Equal(t, 2, getter.eventLoads)
+	// one scan per configured server type and per server type only events asked for
+	assert.Equal(t, 2, getter.scans)
+
+	servers, err := reg.GetEventServers(context.Background(), "chat", "show")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.ChatServer{hosting}, servers)
+	assert.Equal(t, 2, getter.eventLoads)
+}
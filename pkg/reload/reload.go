@@ -0,0 +1,240 @@
+package reload
+
+import (
+	"expvar"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// TriggerSignal reloads are asked by a SIGHUP
+	TriggerSignal = "sighup"
+	// TriggerFile reloads follow a change of the config file
+	TriggerFile = "file"
+	// TriggerAdmin reloads are asked through the admin API
+	TriggerAdmin = "admin"
+)
+
+var reloadMetrics = expvar.NewMap("config_reload")
+
+// ReadFunc reads and validates the config again
+type ReadFunc func() (config.Config, error)
+
+// ApplyFunc applies next given the live keys changed since the current config, nothing must
+// be applied when it fails
+type ApplyFunc func(next config.Config, changed []string) error
+
+// Settings of the config reloader
+type Settings struct {
+	// File watched for changes, only SIGHUP and Trigger reload when empty
+	File string
+	// WatchInterval between checks of File, it isn't watched when zero
+	WatchInterval time.Duration
+}
+
+// Result of a config reload
+type Result struct {
+	At      time.Time `json:"at"`
+	Trigger string    `json:"trigger"`
+	// Applied live keys changed by the reload
+	Applied []string `json:"applied,omitempty"`
+	// RestartRequired keys changed since the process started that only apply after a restart
+	RestartRequired []string `json:"restart_required,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Status reloader settings and reloads summary
+type Status struct {
+	File          string  `json:"file,omitempty"`
+	WatchInterval string  `json:"watch_interval"`
+	Reloads       int     `json:"reloads"`
+	Failures      int     `json:"failures"`
+	LastReload    *Result `json:"last_reload,omitempty"`
+}
+
+// fileState tells the config file changed when it differs from the previous check
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader reads the config again on SIGHUP, file changes or Trigger and applies the keys
+// that can change live, the rest are reported as requiring a restart
+type Reloader struct {
+	read     ReadFunc
+	apply    ApplyFunc
+	settings Settings
+
+	mu       sync.Mutex
+	started  config.Config
+	current  config.Config
+	reloads  int
+	failures int
+	last     *Result
+
+	notify chan struct{}
+	stop   chan struct{}
+}
+
+// New creates new config reloader, current is the config the process started with
+func New(current config.Config, read ReadFunc, apply ApplyFunc, settings Settings) *Reloader {
+	return &Reloader{
+		read:     read,
+		apply:    apply,
+		settings: settings,
+		started:  current,
+		current:  current,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Reload reads the config and applies its live changes, the current config is kept when it
+// is invalid or can't be applied
+func (r *Reloader) Reload(trigger string) (Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := Result{At: time.Now(), Trigger: trigger}
+
+	next, err := r.read()
+	if err == nil {
+		var live []string
+		live, _ = config.Changes(r.current, next)
+		_, result.RestartRequired = config.Changes(r.started, next)
+
+		if len(live) > 0 {
+			err = r.apply(next, live)
+		}
+		if err == nil {
+			result.Applied = live
+			r.current = next
+		}
+	}
+
+	r.reloads++
+	reloadMetrics.Add("reloads", 1)
+	if err != nil {
+		result.Error = err.Error()
+		r.failures++
+		reloadMetrics.Add("failures", 1)
+	}
+	r.last = &result
+
+	entry := log.WithFields(log.Fields{
+		"trigger":          result.Trigger,
+		"applied":          result.Applied,
+		"restart_required": result.RestartRequired,
+	})
+	switch {
+	case err != nil:
+		entry.WithField("error", err).Error("config reload failed, keeping current config")
+	case len(result.RestartRequired) > 0:
+		entry.Warn("config reloaded, some changes require a restart")
+	default:
+		entry.Info("config reloaded")
+	}
+
+	return result, err
+}
+
+// Trigger asks the background loop to reload as soon as possible
+func (r *Reloader) Trigger() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start reloads in background on SIGHUP and when the config file changes until Stop is called
+func (r *Reloader) Start() {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	r.mu.Unlock()
+
+	// set up before returning so a SIGHUP or a file change right after Start isn't missed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	state := r.fileState()
+
+	go func() {
+		defer signal.Stop(signals)
+
+		var ticks <-chan time.Time
+		if len(r.settings.File) > 0 && r.settings.WatchInterval > 0 {
+			ticker := time.NewTicker(r.settings.WatchInterval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-signals:
+				r.Reload(TriggerSignal)
+			case <-r.notify:
+				r.Reload(TriggerAdmin)
+			case <-ticks:
+				if next := r.fileState(); next != state {
+					state = next
+					r.Reload(TriggerFile)
+				}
+			}
+		}
+	}()
+}
+
+// fileState stats the config file, a missing file has the zero state
+func (r *Reloader) fileState() fileState {
+	if len(r.settings.File) == 0 {
+		return fileState{}
+	}
+
+	info, err := os.Stat(r.settings.File)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// Stop stops background reloads
+func (r *Reloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Status returns the reloader settings and the result of the last reload
+func (r *Reloader) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := Status{
+		File:          r.settings.File,
+		WatchInterval: r.settings.WatchInterval.String(),
+		Reloads:       r.reloads,
+		Failures:      r.failures,
+	}
+
+	if r.last != nil {
+		last := *r.last
+		status.LastReload = &last
+	}
+
+	return status
+}
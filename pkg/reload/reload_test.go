@@ -0,0 +1,194 @@
+package reload
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// configFile is a config file the tests rewrite between reloads
+type configFile struct {
+	t    *testing.T
+	name string
+}
+
+func newConfigFile(t *testing.T, content string) *configFile {
+	file, err := ioutil.TempFile("", "ws-message-dispatcher-*.yaml")
+	if err != nil {
+		t.Fatalf("unable to create config file: %s", err)
+	}
+	file.Close()
+	t.Cleanup(func() { os.Remove(file.Name()) })
+
+	cf := &configFile{t: t, name: file.Name()}
+	cf.write(content)
+	return cf
+}
+
+func (cf *configFile) write(content string) {
+	if err := ioutil.WriteFile(cf.name, []byte(content), 0644); err != nil {
+		cf.t.Fatalf("unable to write config file: %s", err)
+	}
+}
+
+func (cf *configFile) read() (config.Config, error) {
+	return config.Read([]string{"--config", cf.name})
+}
+
+type applyRecorder struct {
+	err error
+
+	mu      sync.Mutex
+	applied []config.Config
+	changed [][]string
+}
+
+func (ar *applyRecorder) apply(next config.Config, changed []string) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.err != nil {
+		return ar.err
+	}
+	ar.applied = append(ar.applied, next)
+	ar.changed = append(ar.changed, changed)
+	return nil
+}
+
+func (ar *applyRecorder) count() int {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return len(ar.applied)
+}
+
+func newReloader(t *testing.T, cf *configFile, ar *applyRecorder, settings Settings) *Reloader {
+	current, err := cf.read()
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	return New(current, cf.read, ar.apply, settings)
+}
+
+func TestReload(t *testing.T) {
+	cf := newConfigFile(t, `
+lambda:
+  function: "first"
+`)
+	ar := &applyRecorder{}
+	r := newReloader(t, cf, ar, Settings{File: cf.name})
+
+	// nothing changed
+	result, err := r.Reload(TriggerAdmin)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Applied)
+	assert.Equal(t, 0, ar.count())
+
+	cf.write(`
+lambda:
+  function: "second"
+http:
+  host: ":9999"
+`)
+	result, err = r.Reload(TriggerSignal)
+	if assert.NoError(t, err) {
+		assert.Equal(t, TriggerSignal, result.Trigger)
+		assert.Equal(t, []string{"lambda.function"}, result.Applied)
+		assert.Equal(t, []string{"http.host"}, result.RestartRequired)
+		if assert.Equal(t, 1, ar.count()) {
+			assert.Equal(t, "second", ar.applied[0].Lambda.Function)
+		}
+	}
+
+	// the restart is still required even when nothing else changes
+	result, err = r.Reload(TriggerAdmin)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Applied)
+	assert.Equal(t, []string{"http.host"}, result.RestartRequired)
+	assert.Equal(t, 1, ar.count())
+
+	status := r.Status()
+	assert.Equal(t, 3, status.Reloads)
+	assert.Equal(t, 0, status.Failures)
+	assert.Equal(t, TriggerAdmin, status.LastReload.Trigger)
+}
+
+func TestReloadKeepsCurrentConfig(t *testing.T) {
+	cf := newConfigFile(t, `
+lambda:
+  function: "first"
+`)
+	ar := &applyRecorder{}
+	r := newReloader(t, cf, ar, Settings{File: cf.name})
+
+	// invalid config
+	cf.write(`
+lambda:
+  function: ""
+`)
+	result, err := r.Reload(TriggerFile)
+	assert.Error(t, err)
+	assert.NotEmpty(t, result.Error)
+	assert.Equal(t, 0, ar.count())
+
+	// the apply fails
+	cf.write(`
+lambda:
+  function: "second"
+`)
+	ar.err = errors.New("unable to connect")
+	result, err = r.Reload(TriggerFile)
+	assert.Equal(t, ar.err, err)
+	assert.Empty(t, result.Applied)
+
+	// the change is applied again as the current config was kept
+	ar.err = nil
+	result, err = r.Reload(TriggerFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lambda.function"}, result.Applied)
+
+	status := r.Status()
+	assert.Equal(t, 3, status.Reloads)
+	assert.Equal(t, 2, status.Failures)
+}
+
+func TestStart(t *testing.T) {
+	cf := newConfigFile(t, `
+lambda:
+  function: "first"
+`)
+	ar := &applyRecorder{}
+	r := newReloader(t, cf, ar, Settings{File: cf.name, WatchInterval: 5 * time.Millisecond})
+
+	r.Start()
+	defer r.Stop()
+
+	cf.write(`
+lambda:
+  function: "second-function"
+`)
+	assert.Eventually(t, func() bool { return ar.count() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, TriggerFile, r.Status().LastReload.Trigger)
+
+	cf.write(`
+lambda:
+  region: "us-west-2"
+  function: "second-function"
+`)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	assert.Eventually(t, func() bool { return ar.count() == 2 }, time.Second, time.Millisecond)
+	// the watcher and the SIGHUP both reload whichever sees the change first
+	assert.Eventually(t, func() bool { return r.Status().Reloads >= 3 }, time.Second, time.Millisecond)
+
+	r.Trigger()
+	assert.Eventually(t, func() bool {
+		last := r.Status().LastReload
+		return last != nil && last.Trigger == TriggerAdmin
+	}, time.Second, time.Millisecond)
+}
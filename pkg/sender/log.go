@@ -0,0 +1,33 @@
+package sender
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type logSender struct{}
+
+// NewLog creates a sender that only logs the messages, it lets api-gateway dispatches run
+// locally without AWS
+func NewLog() logSender {
+	return logSender{}
+}
+
+// SendMessage logs msg and the connections it would be sent to
+func (logSender) SendMessage(ctx context.Context, connections []string, msg interface{}) error {
+	log.WithFields(log.Fields{
+		"connections": connections,
+		"message":     msg,
+	}).Info("message not sent, log sender")
+	return ctx.Err()
+}
+
+// SendStream logs msg and the connections of every page, pages is drained until closed
+func (ls logSender) SendStream(ctx context.Context, pages <-chan []string, msg interface{}) error {
+	var connections []string
+	for page := range pages {
+		connections = append(connections, page...)
+	}
+	return ls.SendMessage(ctx, connections, msg)
+}
@@ -1,11 +1,14 @@
 package sender
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,9 +22,12 @@ const percentageGraceSingleLambda = .2
 
 const maxRequestGraceSingleLambda = maxRequestPerLambda * percentageGraceSingleLambda
 
-// SendMessage send messages to ws-MessageSender lambda
-func (s sender) SendMessage(connections []string, msg interface{}) {
+// SendMessage send messages to ws-MessageSender lambda, it returns the first invocation error
+// or the context error when ctx expires before every lambda answers
+func (s sender) SendMessage(ctx context.Context, connections []string, msg interface{}) error {
 	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var sendErr error
 	startTime := time.Now()
 	connectionsLen := len(connections)
 
@@ -54,7 +60,7 @@ func (s sender) SendMessage(connections []string, msg interface{}) {
 		}).Info("SendMessage")
 
 		wg.Add(1)
-		go s.LambdaHandler(payload, &wg)
+		go s.lambdaWorker(ctx, payload, &wg, &errOnce, &sendErr)
 
 	} else {
 		for idx := 0; idx < connectionsLen; idx += maxRequestPerLambda {
@@ -76,22 +82,92 @@ func (s sender) SendMessage(connections []string, msg interface{}) {
 			}).Info("SendMessage")
 
 			wg.Add(1)
-			go s.LambdaHandler(payload, &wg)
+			go s.lambdaWorker(ctx, payload, &wg, &errOnce, &sendErr)
 		}
 	}
 
 	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sendErr
 }
 
-func (s sender) LambdaHandler(payload payloadLambdaRequest, wg *sync.WaitGroup) {
+// SendStream sends messages to ws-MessageSender lambda while connections arrive through pages,
+// a lambda is invoked as soon as maxRequestPerLambda connections are available and the rest
+// once pages is closed. pages is drained until closed even after ctx expires, it returns the
+// first invocation error or the context error
+func (s sender) SendStream(ctx context.Context, pages <-chan []string, msg interface{}) error {
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var sendErr error
+	startTime := time.Now()
+	connectionsLen, lambdas := 0, 0
+
+	defer func() {
+		log.WithFields(log.Fields{
+			"total-connections": connectionsLen,
+			"lambdas":           lambdas,
+			"elapse-time":       time.Since(startTime),
+		}).Info("lambda working time")
+	}()
+
+	chunk := make([]string, 0, maxRequestPerLambda)
+	dispatch := func() {
+		if ctx.Err() == nil {
+			log.WithFields(log.Fields{
+				"sending_to_n_connections": len(chunk),
+			}).Info("SendStream")
+
+			wg.Add(1)
+			go s.lambdaWorker(ctx, payloadLambdaRequest{Message: msg, ConnectionIDS: chunk}, &wg, &errOnce, &sendErr)
+			lambdas++
+		}
+		chunk = make([]string, 0, maxRequestPerLambda)
+	}
+
+	for page := range pages {
+		for _, id := range page {
+			chunk = append(chunk, id)
+			connectionsLen++
+
+			if len(chunk) == maxRequestPerLambda {
+				dispatch()
+			}
+		}
+	}
+
+	if len(chunk) > 0 {
+		dispatch()
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sendErr
+}
+
+func (s sender) lambdaWorker(ctx context.Context, payload payloadLambdaRequest, wg *sync.WaitGroup, errOnce *sync.Once, sendErr *error) {
 	defer wg.Done()
 
+	if err := s.LambdaHandler(ctx, payload); err != nil {
+		errOnce.Do(func() {
+			*sendErr = err
+		})
+	}
+}
+
+// LambdaHandler invokes the sender lambda with payload
+func (s sender) LambdaHandler(ctx context.Context, payload payloadLambdaRequest) error {
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 		}).Error("Json Marshalling error")
-		return
+		return err
 	}
 
 	input := &lambda.InvokeInput{
@@ -99,14 +175,35 @@ func (s sender) LambdaHandler(payload payloadLambdaRequest, wg *sync.WaitGroup)
 		Payload:      payloadJSON,
 	}
 
-	result, err := s.Invoke(input)
+	// a cancelled or expired ctx is the caller giving up, it doesn't count against the lambda
+	err = s.breakers.DoContext(ctx, *s.lambdaName, func() error {
+		result, err := s.InvokeWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"result_lambda": result,
+		}).Info("LambdaHandler")
+
+		if result.FunctionError != nil {
+			return fmt.Errorf("lambda function error: %s", *result.FunctionError)
+		}
+		return nil
+	})
+
+	if err == breaker.ErrOpen {
+		log.WithFields(log.Fields{
+			"lambda":      *s.lambdaName,
+			"connections": len(payload.ConnectionIDS),
+		}).Warn("circuit open, message dropped")
+		return err
+	}
+
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 		}).Error("LambdaHandler")
 	}
-
-	log.WithFields(log.Fields{
-		"result_lambda": result,
-	}).Info("LambdaHandler")
+	return err
 }
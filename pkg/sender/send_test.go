@@ -0,0 +1,129 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+type lambdaMock struct {
+	lambdaiface.LambdaAPI
+
+	mu          sync.Mutex
+	invocations [][]string
+	err         error
+}
+
+func (lm *lambdaMock) InvokeWithContext(ctx aws.Context, input *lambda.InvokeInput, opts ...request.Option) (*lambda.InvokeOutput, error) {
+	payload := payloadLambdaRequest{}
+	if err := json.Unmarshal(input.Payload, &payload); err != nil {
+		return nil, err
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.invocations = append(lm.invocations, payload.ConnectionIDS)
+	return &lambda.InvokeOutput{}, lm.err
+}
+
+func TestSendStream(t *testing.T) {
+	testCases := []struct {
+		testName       string
+		pages          []int
+		err            error
+		expectedChunks []int
+		expectedErr    bool
+	}{
+		{
+			testName:       "SingleChunkCase",
+			pages:          []int{100, 200},
+			expectedChunks: []int{300},
+		},
+		{
+			testName:       "ChunksAcrossPagesCase",
+			pages:          []int{1000, 2500, 1000, 2000},
+			expectedChunks: []int{3000, 3000, 500},
+		},
+		{
+			testName: "NoConnectionsCase",
+			pages:    []int{},
+		},
+		{
+			testName:       "InvocationErrorCase",
+			pages:          []int{10},
+			err:            errors.New("throttled"),
+			expectedChunks: []int{10},
+			expectedErr:    true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			mock := &lambdaMock{err: c.err}
+			s := sender{mock, aws.String("ws-messagesender"), breaker.New(breaker.Settings{})}
+
+			pages := make(chan []string)
+			go func() {
+				id := 0
+				for _, size := range c.pages {
+					page := make([]string, size)
+					for i := range page {
+						page[i] = fmt.Sprintf("conn-%d", id)
+						id++
+					}
+					pages <- page
+				}
+				close(pages)
+			}()
+
+			err := s.SendStream(context.Background(), pages, "message")
+			assert.Equal(t, c.expectedErr, err != nil)
+
+			var chunks []int
+			seen := make(map[string]bool)
+			for _, invocation := range mock.invocations {
+				chunks = append(chunks, len(invocation))
+				for _, id := range invocation {
+					seen[id] = true
+				}
+			}
+			assert.ElementsMatch(t, c.expectedChunks, chunks)
+
+			total := 0
+			for _, size := range c.pages {
+				total += size
+			}
+			assert.Len(t, seen, total)
+		})
+	}
+}
+
+func TestSendStreamDrainsAfterDeadline(t *testing.T) {
+	mock := &lambdaMock{}
+	s := sender{mock, aws.String("ws-messagesender"), breaker.New(breaker.Settings{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pages := make(chan []string)
+	go func() {
+		for i := 0; i < 3; i++ {
+			pages <- make([]string, 3000)
+		}
+		close(pages)
+	}()
+
+	assert.Equal(t, context.Canceled, s.SendStream(ctx, pages, "message"))
+	assert.Empty(t, mock.invocations)
+}
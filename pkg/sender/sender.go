@@ -4,15 +4,18 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
 )
 
 type sender struct {
-	*lambda.Lambda
+	lambdaiface.LambdaAPI
 	lambdaName *string
+	breakers   *breaker.Set
 }
 
 // New Creates new sender instance
-func New(region, funcName string) sender {
+func New(region, funcName string, breakers *breaker.Set) sender {
 
 	sess := session.New(&aws.Config{
 		Region: &region,
@@ -22,5 +25,6 @@ func New(region, funcName string) sender {
 	return sender{
 		Lambda,
 		aws.String(funcName),
+		breakers,
 	}
 }
@@ -0,0 +1,49 @@
+package sender
+
+import (
+	"context"
+	"sync"
+)
+
+// MessageSender sends messages to api-gateway connections
+type MessageSender interface {
+	SendMessage(ctx context.Context, connections []string, msg interface{}) error
+	SendStream(ctx context.Context, pages <-chan []string, msg interface{}) error
+}
+
+// Swappable sends through a sender replaced on config reloads, sends in flight finish with
+// the sender they started with
+type Swappable struct {
+	mu      sync.RWMutex
+	current MessageSender
+}
+
+// NewSwappable creates a sender sending through s until it is swapped
+func NewSwappable(s MessageSender) *Swappable {
+	return &Swappable{current: s}
+}
+
+// Swap sends the next messages through next
+func (sw *Swappable) Swap(next MessageSender) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.current = next
+}
+
+func (sw *Swappable) load() MessageSender {
+	sw.mu.RLock()
+	defer sw.mu.RUnlock()
+
+	return sw.current
+}
+
+// SendMessage sends through the current sender
+func (sw *Swappable) SendMessage(ctx context.Context, connections []string, msg interface{}) error {
+	return sw.load().SendMessage(ctx, connections, msg)
+}
+
+// SendStream sends through the current sender
+func (sw *Swappable) SendStream(ctx context.Context, pages <-chan []string, msg interface{}) error {
+	return sw.load().SendStream(ctx, pages, msg)
+}
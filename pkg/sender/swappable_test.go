@@ -0,0 +1,42 @@
+package sender
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwappable(t *testing.T) {
+	breakers := breaker.New(breaker.Settings{})
+	prev := &lambdaMock{}
+	next := &lambdaMock{}
+
+	sw := NewSwappable(sender{prev, aws.String("ws-messagesender"), breakers})
+	assert.NoError(t, sw.SendMessage(context.Background(), []string{"conn-1"}, "message"))
+
+	sw.Swap(sender{next, aws.String("ws-messagesender-v2"), breakers})
+	assert.NoError(t, sw.SendMessage(context.Background(), []string{"conn-2"}, "message"))
+
+	assert.Equal(t, [][]string{{"conn-1"}}, prev.invocations)
+	assert.Equal(t, [][]string{{"conn-2"}}, next.invocations)
+}
+
+func TestSwappableToLog(t *testing.T) {
+	breakers := breaker.New(breaker.Settings{})
+	lambda := &lambdaMock{}
+
+	sw := NewSwappable(sender{lambda, aws.String("ws-messagesender"), breakers})
+	sw.Swap(NewLog())
+
+	pages := make(chan []string, 2)
+	pages <- []string{"conn-1"}
+	pages <- []string{"conn-2"}
+	close(pages)
+
+	assert.NoError(t, sw.SendMessage(context.Background(), []string{"conn-1"}, "message"))
+	assert.NoError(t, sw.SendStream(context.Background(), pages, "message"))
+	assert.Empty(t, lambda.invocations)
+}
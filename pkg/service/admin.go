@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// Breakers reports the state of every downstream circuit breaker
+func (s service) Breakers(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.breakers.Statuses())
+}
+
+// ChatServersHealth reports the health of every known chat server
+func (s service) ChatServersHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.health.Statuses())
+}
+
+// ChatServers reports the chat servers registry snapshot
+func (s service) ChatServers(c echo.Context) error {
+	if s.registry == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	return c.JSON(http.StatusOK, s.registry.Status())
+}
+
+// RefreshChatServers asks the chat servers registry to reload the servers table
+func (s service) RefreshChatServers(c echo.Context) error {
+	if s.registry == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	s.registry.Refresh()
+	return c.JSON(http.StatusAccepted, response{Success: true})
+}
+
+// EventConfigs reports the per event dispatch settings snapshot
+func (s service) EventConfigs(c echo.Context) error {
+	if s.eventConfigs == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	return c.JSON(http.StatusOK, s.eventConfigs.Status())
+}
+
+// RefreshEventConfigs asks the event configs cache to reload the chat config table
+func (s service) RefreshEventConfigs(c echo.Context) error {
+	if s.eventConfigs == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	s.eventConfigs.Refresh()
+	return c.JSON(http.StatusAccepted, response{Success: true})
+}
+
+// Reaper reports the stale connections reaper settings and its last run
+func (s service) Reaper(c echo.Context) error {
+	if s.reaper == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	return c.JSON(http.StatusOK, s.reaper.Status())
+}
+
+// RunReaper asks the stale connections reaper to run as soon as possible
+func (s service) RunReaper(c echo.Context) error {
+	if s.reaper == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	s.reaper.Trigger()
+	return c.JSON(http.StatusAccepted, response{Success: true})
+}
+
+// ConfigReload reports the config file watched and the result of the last reload
+func (s service) ConfigReload(c echo.Context) error {
+	if s.reloader == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	return c.JSON(http.StatusOK, s.reloader.Status())
+}
+
+// RunConfigReload asks to reload the config as soon as possible
+func (s service) RunConfigReload(c echo.Context) error {
+	if s.reloader == nil {
+		return c.JSON(http.StatusNotFound, response{Success: false})
+	}
+	s.reloader.Trigger()
+	return c.JSON(http.StatusAccepted, response{Success: true})
+}
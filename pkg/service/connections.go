@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+)
+
+var errNoConnectionsCache = errors.New("connections cache is disabled")
+
+type invalidationRequest struct {
+	EventSubdomain string `json:"event_subdomain"`
+}
+
+type invalidationResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// InvalidateConnections drops the cached connections of an event, the connector calls it
+// when users connect or disconnect; every event is dropped when event_subdomain is empty
+func (s service) InvalidateConnections(c echo.Context) error {
+	if s.invalidator == nil {
+		return c.JSON(http.StatusNotFound, invalidationResponse{Error: errNoConnectionsCache.Error()})
+	}
+
+	req := invalidationRequest{}
+
+	if err := c.Bind(&req); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("unable to decode invalidation")
+		return c.JSON(http.StatusBadRequest, invalidationResponse{Error: err.Error()})
+	}
+
+	if len(req.EventSubdomain) == 0 {
+		s.invalidator.InvalidateAll()
+		log.Info("connections cache invalidated")
+	} else {
+		s.invalidator.Invalidate(req.EventSubdomain)
+	}
+
+	return c.JSON(http.StatusOK, invalidationResponse{Success: true})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidateConnections(t *testing.T) {
+	testCases := []struct {
+		testName               string
+		requestPost            string
+		withInvalidator        bool
+		expectedHTTPStatusCode int
+		expectedInvalidated    []string
+	}{
+		{
+			testName:               "InvalidateEventCase",
+			requestPost:            `{"event_subdomain":"el-show-de-producto-online"}`,
+			withInvalidator:        true,
+			expectedHTTPStatusCode: http.StatusOK,
+			expectedInvalidated:    []string{"el-show-de-producto-online"},
+		},
+		{
+			testName:               "InvalidateAllCase",
+			requestPost:            `{}`,
+			withInvalidator:        true,
+			expectedHTTPStatusCode: http.StatusOK,
+			expectedInvalidated:    []string{"*"},
+		},
+		{
+			testName:               "CacheDisabledCase",
+			requestPost:            `{"event_subdomain":"el-show-de-producto-online"}`,
+			expectedHTTPStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, c := range testCases {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/connections/invalidate", strings.NewReader(c.requestPost))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		context := e.NewContext(req, rec)
+
+		invalidator := &invalidatorMock{}
+		options := []Option{}
+		if c.withInvalidator {
+			options = append(options, WithConnectionCache(invalidator))
+		}
+		srv := New(connGetter{}, msgSender{}, options...)
+
+		t.Run(c.testName, func(t *testing.T) {
+			if assert.NoError(t, srv.InvalidateConnections(context)) {
+				assert.Equal(t, c.expectedHTTPStatusCode, rec.Code)
+				assert.Equal(t, c.expectedInvalidated, invalidator.invalidated)
+			}
+		})
+	}
+}
+
+type invalidatorMock struct {
+	connGetter
+	invalidated []string
+}
+
+func (im *invalidatorMock) Invalidate(subdomain string) {
+	im.invalidated = append(im.invalidated, subdomain)
+}
+
+func (im *invalidatorMock) InvalidateAll() {
+	im.invalidated = append(im.invalidated, "*")
+}
@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 	"github.com/labstack/echo"
 	log "github.com/sirupsen/logrus"
 )
@@ -11,17 +14,24 @@ import (
 const (
 	apiGatewayChat = "api-gateway"
 	neermeChat     = "chat-server-v2"
+
+	syncParam = "sync"
 )
 
+var errDispatchFailed = errors.New("dispatch failed")
+
 type incomeMessage struct {
 	EventSubdomain string      `json:"event_subdomain"`
 	AudienceType   string      `json:"audience_type"`
-	GatewayType    string      `json:"gateway_type,ommitempty"`
+	GatewayType    string      `json:"gateway_type,omitempty"`
 	Message        interface{} `json:"message"`
 }
 
 type response struct {
-	Success bool `json:"success"`
+	Success  bool             `json:"success"`
+	TimedOut bool             `json:"timed_out,omitempty"`
+	Rejected string           `json:"rejected,omitempty"`
+	Outcome  *dispatchOutcome `json:"outcome,omitempty"`
 }
 
 // TakeIn receives new messages from Ws-message-connector
@@ -33,49 +43,171 @@ func (s service) TakeIn(c echo.Context) error {
 			"error":     err,
 			"incomeMsg": fmt.Sprintf("%#v", incomeMsg),
 		}).Error("unable to decode request")
-		return c.JSON(http.StatusBadRequest, response{false})
+		return c.JSON(http.StatusBadRequest, response{Success: false})
 	}
 
 	if len(incomeMsg.EventSubdomain) == 0 {
 		log.Error("empty event subdomain")
-		return c.JSON(http.StatusBadRequest, response{false})
+		return c.JSON(http.StatusBadRequest, response{Success: false})
 	}
 
 	log.WithFields(log.Fields{"event_subdomain": incomeMsg.EventSubdomain}).Info("request decoded")
-	go s.dispatchMessage(incomeMsg)
 
-	return c.JSON(http.StatusOK, response{true})
+	incomeMsg, err := s.applyEventConfig(incomeMsg)
+	if status, rejected := rejectionStatus[err]; rejected {
+		return c.JSON(status, response{Success: false, Rejected: err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response{Success: false})
+	}
+
+	if c.QueryParam(syncParam) == "true" {
+		outcome, err := s.dispatchMessage(c.Request().Context(), incomeMsg)
+		return c.JSON(http.StatusOK, response{
+			Success:  err == nil,
+			TimedOut: err == context.DeadlineExceeded,
+			Outcome:  outcome,
+		})
+	}
+
+	go s.dispatchMessage(context.Background(), incomeMsg)
+
+	return c.JSON(http.StatusOK, response{Success: true})
 }
 
-func (s service) dispatchMessage(msg incomeMessage) {
-	switch msg.GatewayType {
-	case apiGatewayChat:
-		log.WithFields(log.Fields{"chat-type": apiGatewayChat}).Info("sending messages")
-		s.apigateway(msg)
+// dispatchMessage sends msg, with its event config already applied, through its gateway
+// within the gateway overall deadline, the outcome is only reported for server types and
+// context.DeadlineExceeded is returned on timeouts
+func (s service) dispatchMessage(ctx context.Context, msg incomeMessage) (*dispatchOutcome, error) {
+	serverType, isServerType := s.serverTypes[msg.GatewayType]
 
-	case neermeChat:
-		log.WithFields(log.Fields{"chat-type": neermeChat}).Info("sending messages")
-		s.neermeChat(msg)
+	gatewayType := apiGatewayChat
+	if isServerType {
+		gatewayType = msg.GatewayType
+	}
+
+	timeouts := s.timeoutsFor(gatewayType)
+	ctx, cancel := context.WithTimeout(ctx, timeouts.Overall)
+	defer cancel()
+
+	switch {
+	case msg.GatewayType == apiGatewayChat:
+		log.WithFields(log.Fields{"chat-type": apiGatewayChat}).Info("sending messages")
+		return nil, s.apigateway(ctx, msg, timeouts)
+
+	case isServerType:
+		log.WithFields(log.Fields{"chat-type": msg.GatewayType, "server-type": serverType.Name}).Info("sending messages")
+		outcome := s.publishToServers(ctx, msg, serverType, timeouts)
+		if outcome.TimedOut {
+			return &outcome, context.DeadlineExceeded
+		}
+		if len(outcome.Error) > 0 {
+			return &outcome, errDispatchFailed
+		}
+		return &outcome, nil
 
 	default:
 		log.WithFields(log.Fields{"type": msg.GatewayType, "default": apiGatewayChat}).Info("using default gateway")
-		s.apigateway(msg)
+		return nil, s.apigateway(ctx, msg, timeouts)
 	}
 }
 
-func (s service) apigateway(msg incomeMessage) {
-	var connections []string
+func (s service) apigateway(ctx context.Context, msg incomeMessage, timeouts Timeouts) error {
+	if streamer, isStreamer := s.dbUser.(connectionStreamer); isStreamer {
+		if sender, isSender := s.sender.(messageStreamer); isSender {
+			return s.apigatewayStream(ctx, msg, timeouts, streamer, sender)
+		}
+	}
+
+	var connections []store.Connection
+
+	lookupCtx, cancelLookup := context.WithTimeout(ctx, timeouts.Lookup)
+	defer cancelLookup()
+
+	if err := s.dbUser.GetUserConnections(lookupCtx, msg.EventSubdomain, msg.AudienceType, &connections); err != nil {
+		if timedOut(lookupCtx, err) {
+			logTimeout(msg, stageLookup, timeouts.Lookup)
+			return context.DeadlineExceeded
+		}
 
-	if err := s.dbUser.GetUserConnections(msg.EventSubdomain, msg.AudienceType, &connections); err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 		}).Error("unable to get user connections")
-		return
+		return err
 	}
 
+	ids := store.ConnectionIDs(connections)
 	log.WithFields(log.Fields{
-		"connections": connections,
+		"connections": ids,
 	}).Info("connections")
 
-	s.sender.SendMessage(connections, msg.Message)
+	sendCtx, cancelSend := context.WithTimeout(ctx, timeouts.Send)
+	defer cancelSend()
+
+	if err := s.sender.SendMessage(sendCtx, ids, msg.Message); err != nil {
+		if timedOut(sendCtx, err) {
+			logTimeout(msg, stageSend, timeouts.Send)
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+
+	return nil
+}
+
+// apigatewayStream overlaps the connections lookup with sending, the send deadline covers both
+// stages since they run together. Connections resolved before a lookup failure are still sent
+func (s service) apigatewayStream(ctx context.Context, msg incomeMessage, timeouts Timeouts, streamer connectionStreamer, sender messageStreamer) error {
+	lookupCtx, cancelLookup := context.WithTimeout(ctx, timeouts.Lookup)
+	defer cancelLookup()
+
+	sendCtx, cancelSend := context.WithTimeout(ctx, timeouts.Lookup+timeouts.Send)
+	defer cancelSend()
+
+	records := make(chan []store.Connection)
+	lookupErr := make(chan error, 1)
+
+	go func() {
+		lookupErr <- streamer.StreamUserConnections(lookupCtx, msg.EventSubdomain, msg.AudienceType, records)
+		close(records)
+	}()
+
+	sendErr := sender.SendStream(sendCtx, connectionIDPages(records), msg.Message)
+
+	if err := <-lookupErr; err != nil {
+		if timedOut(lookupCtx, err) {
+			logTimeout(msg, stageLookup, timeouts.Lookup)
+			return context.DeadlineExceeded
+		}
+
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to stream user connections")
+		return err
+	}
+
+	if sendErr != nil {
+		if timedOut(sendCtx, sendErr) {
+			logTimeout(msg, stageSend, timeouts.Lookup+timeouts.Send)
+			return context.DeadlineExceeded
+		}
+		return sendErr
+	}
+
+	return nil
+}
+
+// connectionIDPages forwards the ids of every page of records, the returned channel is
+// closed once records is
+func connectionIDPages(records <-chan []store.Connection) <-chan []string {
+	pages := make(chan []string)
+
+	go func() {
+		defer close(pages)
+		for page := range records {
+			pages <- store.ConnectionIDs(page)
+		}
+	}()
+
+	return pages
 }
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 )
@@ -69,18 +71,25 @@ func TestTakeIn(t *testing.T) {
 	}
 }
 
-type connGetter struct{}
+type connGetter struct {
+	servers      []store.ChatServer
+	eventServers []store.ChatServer
+}
 
-func (cg connGetter) GetUserConnections(eventSubdomain string, audienceType string, connections *[]string) error {
+func (cg connGetter) GetUserConnections(ctx context.Context, eventSubdomain string, audienceType string, connections *[]store.Connection) error {
 	return nil
 }
 
-func (cg connGetter) GetServerConnections(servers map[string]int) error {
-	return nil
+func (cg connGetter) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	return append([]store.ChatServer(nil), cg.servers...), nil
 }
 
-type msgSender struct{}
+func (cg connGetter) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	return append([]store.ChatServer(nil), cg.eventServers...), nil
+}
 
-func (ms msgSender) SendMessage(connections []string, msg interface{}) {
+type msgSender struct{}
 
+func (ms msgSender) SendMessage(ctx context.Context, connections []string, msg interface{}) error {
+	return nil
 }
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/eventconfig"
+	"github.com/boletia/ws-message-dispatcher/pkg/ratelimit"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	audienceOrganizer  = "organizer"
+	audienceAttendance = "attendance"
+)
+
+var (
+	errEventPaused      = errors.New("event is paused")
+	errEventMuted       = errors.New("event is muted")
+	errAudienceDisabled = errors.New("audience is disabled for the event")
+	errMessageTooLarge  = errors.New("message exceeds the event size cap")
+	errRateLimited      = errors.New("event rate limit exceeded")
+
+	rejectionMetrics = expvar.NewMap("event_rejections")
+
+	// rejectionStatus http status of the messages rejected by their event config
+	rejectionStatus = map[error]int{
+		errEventPaused:      http.StatusServiceUnavailable,
+		errEventMuted:       http.StatusOK,
+		errAudienceDisabled: http.StatusForbidden,
+		errMessageTooLarge:  http.StatusRequestEntityTooLarge,
+		errRateLimited:      http.StatusTooManyRequests,
+	}
+)
+
+type eventConfigGetter interface {
+	Get(subdomain string) (store.EventConfig, bool)
+	Refresh()
+	Status() eventconfig.Status
+}
+
+// applyEventConfig applies msg event settings, the message is returned with its defaults
+// filled or an error telling why it must not be dispatched
+func (s service) applyEventConfig(msg incomeMessage) (incomeMessage, error) {
+	if s.eventConfigs == nil {
+		return msg, nil
+	}
+
+	config, exists := s.eventConfigs.Get(msg.EventSubdomain)
+	if !exists {
+		return msg, nil
+	}
+
+	err := s.checkEventConfig(&msg, config)
+	if err != nil {
+		rejectionMetrics.Add(err.Error(), 1)
+		log.WithFields(log.Fields{
+			"event_subdomain": msg.EventSubdomain,
+			"audience_type":   msg.AudienceType,
+			"reason":          err,
+		}).Warn("message rejected by event config")
+	}
+
+	return msg, err
+}
+
+func (s service) checkEventConfig(msg *incomeMessage, config store.EventConfig) error {
+	if config.Paused {
+		return errEventPaused
+	}
+	if config.Muted {
+		return errEventMuted
+	}
+
+	if len(msg.GatewayType) == 0 {
+		msg.GatewayType = config.DefaultGateway
+	}
+
+	if !audienceEnabled(msg, config.Audiences) {
+		return errAudienceDisabled
+	}
+
+	if config.MaxMessageBytes > 0 {
+		payload, err := json.Marshal(msg.Message)
+		if err != nil {
+			return err
+		}
+		if len(payload) > config.MaxMessageBytes {
+			return errMessageTooLarge
+		}
+	}
+
+	if !s.limiter.Allow(msg.EventSubdomain, ratelimit.Limit{Rate: config.RateLimit, Burst: config.RateBurst}) {
+		return errRateLimited
+	}
+
+	return nil
+}
+
+// audienceEnabled tells if msg audience is enabled, messages for every audience are narrowed
+// to the only enabled one
+func audienceEnabled(msg *incomeMessage, audiences []string) bool {
+	if len(audiences) == 0 {
+		return true
+	}
+
+	if msg.AudienceType != audienceOrganizer && msg.AudienceType != audienceAttendance {
+		if len(audiences) == 1 {
+			msg.AudienceType = audiences[0]
+		}
+		return true
+	}
+
+	for _, audience := range audiences {
+		if audience == msg.AudienceType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/eventconfig"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventConfig(t *testing.T) {
+	testCases := []struct {
+		testName               string
+		config                 store.EventConfig
+		requestPost            string
+		requests               int
+		expectedHTTPStatusCode int
+		expectedResponse       string
+		expectedConnections    []string
+	}{
+		{
+			testName:               "NotConfiguredCase",
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedHTTPStatusCode: http.StatusOK,
+			expectedResponse:       "{\"success\":true}\n",
+			expectedConnections:    []string{"conn-1"},
+		},
+		{
+			testName:               "PausedCase",
+			config:                 store.EventConfig{Paused: true},
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedHTTPStatusCode: http.StatusServiceUnavailable,
+			expectedResponse:       "{\"success\":false,\"rejected\":\"event is paused\"}\n",
+		},
+		{
+			testName:               "MutedCase",
+			config:                 store.EventConfig{Muted: true},
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedHTTPStatusCode: http.StatusOK,
+			expectedResponse:       "{\"success\":false,\"rejected\":\"event is muted\"}\n",
+		},
+		{
+			testName:               "AudienceDisabledCase",
+			config:                 store.EventConfig{Audiences: []string{"organizer"}},
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedHTTPStatusCode: http.StatusForbidden,
+			expectedResponse:       "{\"success\":false,\"rejected\":\"audience is disabled for the event\"}\n",
+		},
+		{
+			testName:               "MessageTooLargeCase",
+			config:                 store.EventConfig{MaxMessageBytes: 8},
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedHTTPStatusCode: http.StatusRequestEntityTooLarge,
+			expectedResponse:       "{\"success\":false,\"rejected\":\"message exceeds the event size cap\"}\n",
+		},
+		{
+			testName:               "RateLimitedCase",
+			config:                 store.EventConfig{RateLimit: 0.001, RateBurst: 1},
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			requests:               2,
+			expectedHTTPStatusCode: http.StatusTooManyRequests,
+			expectedResponse:       "{\"success\":false,\"rejected\":\"event rate limit exceeded\"}\n",
+			expectedConnections:    []string{"conn-1"},
+		},
+		{
+			testName:               "DefaultGatewayCase",
+			config:                 store.EventConfig{DefaultGateway: "api-gateway", Audiences: []string{"attendance"}},
+			requestPost:            `{ "event_subdomain":"el-show-de-producto-online", "message": {"active": true} }`,
+			expectedHTTPStatusCode: http.StatusOK,
+			expectedResponse:       "{\"success\":true}\n",
+			expectedConnections:    []string{"conn-1"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			configs := eventConfigsMock{}
+			if c.testName != "NotConfiguredCase" {
+				configs["el-show-de-producto-online"] = c.config
+			}
+
+			sender := &recordingSender{}
+			srv := New(audienceGetter{}, sender, WithEventConfigs(configs))
+
+			requests := c.requests
+			if requests == 0 {
+				requests = 1
+			}
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < requests; i++ {
+				e := echo.New()
+				req := httptest.NewRequest(http.MethodPost, "/?sync=true", strings.NewReader(c.requestPost))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				rec = httptest.NewRecorder()
+
+				assert.NoError(t, srv.TakeIn(e.NewContext(req, rec)))
+			}
+
+			assert.Equal(t, c.expectedHTTPStatusCode, rec.Code)
+			assert.Equal(t, c.expectedResponse, rec.Body.String())
+			assert.Equal(t, c.expectedConnections, sender.connections)
+		})
+	}
+}
+
+func TestEventConfigAsync(t *testing.T) {
+	configs := eventConfigsMock{"el-show-de-producto-online": {Paused: true}}
+	sender := &recordingSender{}
+	srv := New(audienceGetter{}, sender, WithEventConfigs(configs))
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{ "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	assert.NoError(t, srv.TakeIn(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "{\"success\":false,\"rejected\":\"event is paused\"}\n", rec.Body.String())
+	assert.Empty(t, sender.connections)
+}
+
+type eventConfigsMock map[string]store.EventConfig
+
+func (em eventConfigsMock) Get(subdomain string) (store.EventConfig, bool) {
+	config, exists := em[subdomain]
+	return config, exists
+}
+
+func (em eventConfigsMock) Refresh() {}
+
+func (em eventConfigsMock) Status() eventconfig.Status {
+	return eventconfig.Status{Events: em}
+}
+
+// audienceGetter returns one connection for the attendance audience only
+type audienceGetter struct {
+	connGetter
+}
+
+func (ag audienceGetter) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error {
+	if audienceType == "attendance" {
+		*connections = append(*connections, store.Connection{ConnectionID: "conn-1", EventSubdomain: subdomain})
+	}
+	return nil
+}
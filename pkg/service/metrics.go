@@ -0,0 +1,24 @@
+package service
+
+import (
+	"expvar"
+	"time"
+)
+
+var chatMetrics = expvar.NewMap("chat_dispatch")
+
+func recordChatOutcome(outcome dispatchOutcome) {
+	chatMetrics.Add("dispatches", 1)
+	chatMetrics.Add("servers", int64(outcome.Servers))
+	chatMetrics.Add("delivered_messages", int64(outcome.Delivered))
+	chatMetrics.Add("failed_servers", int64(len(outcome.FailedServers)))
+	chatMetrics.Add("skipped_servers", int64(len(outcome.SkippedServers)))
+
+	if len(outcome.Error) > 0 {
+		chatMetrics.Add("errors", 1)
+	}
+
+	if elapse, err := time.ParseDuration(outcome.Elapse); err == nil {
+		chatMetrics.Add("elapse_ms", elapse.Milliseconds())
+	}
+}
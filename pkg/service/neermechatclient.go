@@ -1,84 +1,294 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/boletia/ws-message-dispatcher/pkg/certs"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	defaultChatMaxIdleConnsPerHost = 32
+	defaultChatIdleConnTimeout     = 90 * time.Second
+	defaultChatDialTimeout         = 2 * time.Second
+	defaultChatKeepAlive           = 30 * time.Second
+	maxChatErrorBody               = 512
+)
+
 var (
-	httpMaxTimeOut = 5 * time.Second
+	errChatServerFailure    = errors.New("chat server reported failure")
+	errNoChatServers        = errors.New("there is not configured chat-servers")
+	errNoHealthyChatServers = errors.New("there is not healthy chat-servers")
+	errAllChatServersFailed = errors.New("every chat-server failed")
 )
 
 type chatResponse struct {
 	Success bool   `json:"success"`
-	Error   string `json:"error,ommitempty"`
-	Count   int    `json:"delivered_messages,ommitempty"`
-	Elapse  string `json:"elapse,ommitpemty"`
+	Error   string `json:"error,omitempty"`
+	Count   int    `json:"delivered_messages,omitempty"`
+	Elapse  string `json:"elapse,omitempty"`
+}
+
+// ChatTransportSettings holds the connection pool settings used for chat servers,
+// zero values are replaced by defaults
+type ChatTransportSettings struct {
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+	// TLS enables https connections with the reloader certificates
+	TLS *certs.Reloader
+}
+
+// NewChatClient creates the long-lived http client shared by every chat server delivery
+func NewChatClient(settings ChatTransportSettings) *http.Client {
+	if settings.MaxIdleConnsPerHost <= 0 {
+		settings.MaxIdleConnsPerHost = defaultChatMaxIdleConnsPerHost
+	}
+	if settings.IdleConnTimeout <= 0 {
+		settings.IdleConnTimeout = defaultChatIdleConnTimeout
+	}
+	if settings.DialTimeout <= 0 {
+		settings.DialTimeout = defaultChatDialTimeout
+	}
+	if settings.KeepAlive <= 0 {
+		settings.KeepAlive = defaultChatKeepAlive
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   settings.DialTimeout,
+		KeepAlive: settings.KeepAlive,
+	}
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		MaxIdleConnsPerHost: settings.MaxIdleConnsPerHost,
+		IdleConnTimeout:     settings.IdleConnTimeout,
+	}
+
+	if settings.TLS != nil {
+		transport.DialTLSContext = settings.TLS.DialTLSContext(dialer)
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
 }
 
-func (s service) neermeChat(message interface{}) {
+// dispatchOutcome aggregates the chat servers results of a single dispatch
+type dispatchOutcome struct {
+	ServerType     string   `json:"server_type"`
+	Servers        int      `json:"servers"`
+	Delivered      int      `json:"delivered_messages"`
+	FailedServers  []string `json:"failed_servers,omitempty"`
+	SkippedServers []string `json:"skipped_servers,omitempty"`
+	SlowestServer  string   `json:"slowest_server,omitempty"`
+	SlowestElapse  string   `json:"slowest_elapse,omitempty"`
+	Elapse         string   `json:"elapse"`
+	TimedOut       bool     `json:"timed_out,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+type serverResult struct {
+	server    string
+	delivered int
+	elapse    time.Duration
+	err       error
+}
+
+func (s service) publishToServers(ctx context.Context, message incomeMessage, serverType ServerType, timeouts Timeouts) dispatchOutcome {
 	var wg sync.WaitGroup
-	servers := make(map[string]int, 0)
+	outcome := dispatchOutcome{ServerType: serverType.Name}
+	startTime := time.Now()
+
+	defer func() {
+		outcome.Elapse = time.Since(startTime).String()
+		recordChatOutcome(outcome)
+	}()
+
+	lookupCtx, cancelLookup := context.WithTimeout(ctx, timeouts.Lookup)
+	defer cancelLookup()
+
+	servers, err := s.routeServers(lookupCtx, serverType.Name, message.EventSubdomain)
+	if err != nil {
+		if timedOut(lookupCtx, err) {
+			logTimeout(message, stageLookup, timeouts.Lookup)
+			outcome.TimedOut = true
+		}
 
-	if err := s.dbUser.GetServerConnections(servers); err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 		}).Error("unable to get list of servers")
-		return
+		outcome.Error = err.Error()
+		return outcome
 	}
 
 	if len(servers) < 1 {
 		log.Error("there is not configured chat-servers")
-		return
+		outcome.Error = errNoChatServers.Error()
+		return outcome
 	}
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(httpMaxTimeOut))
-	defer cancel()
+	healthy := servers[:0]
+	for _, server := range servers {
+		target := server.Address()
+		if !s.health.Healthy(target) {
+			log.WithFields(log.Fields{"server": target}).Warn("skipping unhealthy chat server")
+			outcome.SkippedServers = append(outcome.SkippedServers, target)
+			continue
+		}
+		healthy = append(healthy, server)
+	}
+	servers = healthy
 
-	for ipServer, port := range servers {
-		log.WithFields(log.Fields{"server": ipServer}).Info("sending request")
+	if len(servers) < 1 {
+		log.Error("there is not healthy chat-servers")
+		outcome.Error = errNoHealthyChatServers.Error()
+		return outcome
+	}
+
+	payload, err := serverType.payload(message)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("unable to convert messages from interface{} to []byte")
+		outcome.Error = err.Error()
+		return outcome
+	}
+
+	sendCtx, cancelSend := context.WithTimeout(ctx, timeouts.Send)
+	defer cancelSend()
+
+	results := make(chan serverResult, len(servers))
+	for _, server := range servers {
+		log.WithFields(log.Fields{"server": server.IP, "server_type": serverType.Name}).Info("sending request")
 		wg.Add(1)
-		go neermeSendMessages(ctx, ipServer, port, message, &wg)
+		go s.neermeSendThroughBreaker(ctx, sendCtx, serverType, server.IP, server.Port, payload, results, &wg)
 	}
 
 	wg.Wait()
+	close(results)
+
+	outcome.aggregate(results)
+	if sendCtx.Err() == context.DeadlineExceeded {
+		logTimeout(message, stageSend, timeouts.Send)
+		outcome.TimedOut = true
+		outcome.Error = context.DeadlineExceeded.Error()
+	}
+	log.WithFields(log.Fields{
+		"servers":        outcome.Servers,
+		"delivered":      outcome.Delivered,
+		"failed_servers": outcome.FailedServers,
+		"slowest_server": outcome.SlowestServer,
+		"slowest_elapse": outcome.SlowestElapse,
+	}).Info("chat dispatch outcome")
+
+	return outcome
+}
+
+// aggregate sums the results of the contacted servers, the ones behind an open circuit are
+// skipped. The dispatch fails only when no server took the message, a partial failure is
+// reported through FailedServers
+func (o *dispatchOutcome) aggregate(results <-chan serverResult) {
+	var slowest time.Duration
+
+	for result := range results {
+		if result.err == breaker.ErrOpen {
+			o.SkippedServers = append(o.SkippedServers, result.server)
+			continue
+		}
+
+		o.Servers++
+		o.Delivered += result.delivered
+
+		if result.err != nil {
+			o.FailedServers = append(o.FailedServers, result.server)
+		}
+
+		if result.elapse > slowest {
+			slowest = result.elapse
+			o.SlowestServer = result.server
+			o.SlowestElapse = result.elapse.String()
+		}
+	}
+
+	sort.Strings(o.FailedServers)
+	sort.Strings(o.SkippedServers)
+
+	switch {
+	case o.Servers == 0:
+		o.Error = errNoHealthyChatServers.Error()
+	case len(o.FailedServers) == o.Servers:
+		o.Error = errAllChatServersFailed.Error()
+	}
+}
+
+func (s service) clientFor(serverType ServerType) *http.Client {
+	if client, exists := s.serverTypeClients[serverType.Name]; exists {
+		return client
+	}
+	return s.chatClient
 }
 
-func neermeSendMessages(ctx context.Context, ip string, port int, messages interface{}, wg *sync.WaitGroup) {
+// neermeSendThroughBreaker sends payload within ctx, failures once caller is done aren't held
+// against the server by its breaker nor its health
+func (s service) neermeSendThroughBreaker(caller context.Context, ctx context.Context, serverType ServerType, ip string, port int, payload []byte, results chan<- serverResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	reqJSON, err := json.Marshal(messages)
-	if err != nil {
+	target := store.Address(ip, port)
+	result := serverResult{server: target}
+	client := s.clientFor(serverType)
+	url := serverType.publishURL(ip, port)
+
+	result.err = s.breakers.DoContext(caller, target, func() error {
+		startTime := time.Now()
+		response, err := neermeSendMessages(ctx, client, url, ip, payload)
+		result.elapse = time.Since(startTime)
+		result.delivered = response.Count
+		if err != nil && caller.Err() == nil {
+			// the server is probed the way it is sent messages until it recovers
+			s.health.Endpoint(target, serverType.scheme(), client)
+		}
+		if err == nil || caller.Err() == nil {
+			s.health.Record(target, result.elapse, err)
+		}
+		return err
+	})
+
+	if result.err == breaker.ErrOpen {
 		log.WithFields(log.Fields{
-			"error": err,
-			"ip":    ip,
-		}).Error("unable to convert messages from interface{} to []byte")
-		return
+			"server": target,
+		}).Warn("circuit open, skipping chat server")
 	}
-	reqData := strings.NewReader(string(reqJSON))
 
-	reqString := fmt.Sprintf("http://%s:%d/publish/chat/", ip, port)
-	req, err := http.NewRequest("POST", reqString, reqData)
+	results <- result
+}
+
+func neermeSendMessages(ctx context.Context, client *http.Client, url string, ip string, payload []byte) (chatResponse, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
 			"ip":    ip,
 		}).Error("unable to create new request")
-		return
+		return chatResponse{}, err
 	}
 
 	req.Header.Add("Content-Type", "application/json")
 
 	req = req.WithContext(ctx)
-	client := &http.Client{}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -86,8 +296,9 @@ func neermeSendMessages(ctx context.Context, ip string, port int, messages inter
 			"error": err,
 			"ip":    ip,
 		}).Error("unable to send request")
-		return
+		return chatResponse{}, err
 	}
+	defer resp.Body.Close()
 
 	var body []byte
 	if body, err = ioutil.ReadAll(resp.Body); err != nil {
@@ -95,9 +306,21 @@ func neermeSendMessages(ctx context.Context, ip string, port int, messages inter
 			"error": err,
 			"ip":    ip,
 		}).Error("unable to read response")
-		return
+		return chatResponse{}, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		if len(body) > maxChatErrorBody {
+			body = body[:maxChatErrorBody]
+		}
+		err = fmt.Errorf("chat server responded with status %d: %s", resp.StatusCode, body)
+		log.WithFields(log.Fields{
+			"error":  err,
+			"ip":     ip,
+			"status": resp.StatusCode,
+		}).Error("unexpected response status")
+		return chatResponse{}, err
 	}
-	defer resp.Body.Close()
 
 	response := chatResponse{}
 	if err = json.Unmarshal(body, &response); err != nil {
@@ -105,7 +328,7 @@ func neermeSendMessages(ctx context.Context, ip string, port int, messages inter
 			"error": err,
 			"ip":    ip,
 		}).Error("unable to decode response")
-		return
+		return chatResponse{}, err
 	}
 
 	log.WithFields(log.Fields{
@@ -114,4 +337,9 @@ func neermeSendMessages(ctx context.Context, ip string, port int, messages inter
 		"elapse":  response.Elapse,
 		"error":   response.Error,
 	}).Info("response")
+
+	if !response.Success {
+		return response, errChatServerFailure
+	}
+	return response, nil
 }
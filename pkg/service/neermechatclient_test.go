@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/boletia/ws-message-dispatcher/pkg/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeermeSendMessages(t *testing.T) {
+	testCases := []struct {
+		testName          string
+		status            int
+		body              string
+		expectedDelivered int
+		expectedError     bool
+	}{
+		{
+			testName:          "DeliveredCase",
+			status:            http.StatusOK,
+			body:              `{"success":true,"delivered_messages":3,"elapse":"1ms"}`,
+			expectedDelivered: 3,
+		},
+		{
+			testName:      "UnsuccessfulCase",
+			status:        http.StatusOK,
+			body:          `{"success":false,"error":"no clients"}`,
+			expectedError: true,
+		},
+		{
+			testName:      "ServerErrorCase",
+			status:        http.StatusInternalServerError,
+			body:          `upstream exploded`,
+			expectedError: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/publish/chat/", r.URL.Path)
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			}))
+			defer server.Close()
+
+			ip, port := splitHostPort(t, server.Listener.Addr().String())
+			srv := New(connGetter{}, msgSender{})
+			url := DefaultServerTypes()[0].publishURL(ip, port)
+
+			response, err := neermeSendMessages(context.Background(), srv.chatClient, url, ip, []byte(`{"message":"hi"}`))
+			assert.Equal(t, c.expectedDelivered, response.Count)
+			if c.expectedError {
+				assert.Error(t, err)
+				if c.status != http.StatusOK {
+					assert.Contains(t, err.Error(), c.body)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDispatchOutcomeAggregate(t *testing.T) {
+	results := make(chan serverResult, 3)
+	results <- serverResult{server: "10.0.0.1:8080", delivered: 10, elapse: 20 * time.Millisecond}
+	results <- serverResult{server: "10.0.0.2:8080", delivered: 5, elapse: 80 * time.Millisecond}
+	results <- serverResult{server: "10.0.0.3:8080", elapse: time.Second, err: errChatServerFailure}
+	close(results)
+
+	outcome := dispatchOutcome{}
+	outcome.aggregate(results)
+
+	assert.Equal(t, 3, outcome.Servers)
+	assert.Equal(t, 15, outcome.Delivered)
+	assert.Equal(t, []string{"10.0.0.3:8080"}, outcome.FailedServers)
+	assert.Equal(t, "10.0.0.3:8080", outcome.SlowestServer)
+	assert.Equal(t, "1s", outcome.SlowestElapse)
+	assert.Empty(t, outcome.Error)
+}
+
+func TestDispatchOutcomeAggregateFailures(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		results         []serverResult
+		expectedServers int
+		expectedSkipped []string
+		expectedError   error
+	}{
+		{
+			testName: "AllFailedCase",
+			results: []serverResult{
+				{server: "10.0.0.1:8080", err: errChatServerFailure},
+				{server: "10.0.0.2:8080", err: errChatServerFailure},
+			},
+			expectedServers: 2,
+			expectedError:   errAllChatServersFailed,
+		},
+		{
+			testName: "OpenCircuitsCase",
+			results: []serverResult{
+				{server: "10.0.0.2:8080", err: breaker.ErrOpen},
+				{server: "10.0.0.1:8080", err: breaker.ErrOpen},
+			},
+			expectedSkipped: []string{"10.0.0.1:8080", "10.0.0.2:8080"},
+			expectedError:   errNoHealthyChatServers,
+		},
+		{
+			testName: "OpenCircuitAndFailedCase",
+			results: []serverResult{
+				{server: "10.0.0.1:8080", err: breaker.ErrOpen},
+				{server: "10.0.0.2:8080", err: errChatServerFailure},
+			},
+			expectedServers: 1,
+			expectedSkipped: []string{"10.0.0.1:8080"},
+			expectedError:   errAllChatServersFailed,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			results := make(chan serverResult, len(c.results))
+			for _, result := range c.results {
+				results <- result
+			}
+			close(results)
+
+			outcome := dispatchOutcome{}
+			outcome.aggregate(results)
+
+			assert.Equal(t, c.expectedServers, outcome.Servers)
+			assert.Equal(t, c.expectedSkipped, outcome.SkippedServers)
+			assert.Equal(t, c.expectedError.Error(), outcome.Error)
+		})
+	}
+}
+
+func splitHostPort(t *testing.T, addr string) (string, int) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return host, port
+}
+
+func TestNeermeSendThroughBreakerCallerGone(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ip, port := splitHostPort(t, server.Listener.Addr().String())
+	srv := New(connGetter{}, msgSender{}, WithBreakers(breaker.New(breaker.Settings{FailureThreshold: 1})), WithHealth(health.New(health.Settings{UnhealthyAfter: 1})))
+	caller, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	var wg sync.WaitGroup
+	results := make(chan serverResult, 1)
+	wg.Add(1)
+	srv.neermeSendThroughBreaker(caller, caller, DefaultServerTypes()[0], ip, port, []byte(`{"message":"hi"}`), results, &wg)
+
+	assert.Error(t, (<-results).err)
+	target := net.JoinHostPort(ip, strconv.Itoa(port))
+	assert.True(t, srv.health.Healthy(target))
+	assert.Equal(t, breaker.StateClosed.String(), srv.breakers.Statuses()[0].State)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/memory"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOfflinePipeline runs TakeIn through dispatch on the in-memory store
+func TestOfflinePipeline(t *testing.T) {
+	chatServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"delivered_messages":3}`))
+	}))
+	defer chatServer.Close()
+
+	ip, port := splitHostPort(t, chatServer.Listener.Addr().String())
+
+	db := memory.New()
+	db.AddConnection(context.Background(), store.Connection{ConnectionID: "conn-organizer-1", EventSubdomain: "el-show-de-producto-online", IsOrganizer: true})
+	db.AddConnection(context.Background(), store.Connection{ConnectionID: "conn-attendance-1", EventSubdomain: "el-show-de-producto-online"})
+	db.RegisterServer(store.ServerRegistration{IP: ip, Port: port, ServerType: "chat", Events: []string{"el-show-de-producto-online"}})
+
+	testCases := []struct {
+		testName            string
+		requestPost         string
+		expectedConnections []string
+		expectedDelivered   int
+	}{
+		{
+			testName:            "ApiGatewayCase",
+			requestPost:         `{ "gateway_type": "api-gateway", "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedConnections: []string{"conn-attendance-1"},
+		},
+		{
+			testName:          "ChatServerCase",
+			requestPost:       `{ "gateway_type": "chat-server-v2", "event_subdomain":"el-show-de-producto-online", "audience_type":"attendance", "message": {"active": true} }`,
+			expectedDelivered: 3,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/?sync=true", strings.NewReader(c.requestPost))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			sender := &recordingSender{}
+			srv := New(db, sender)
+
+			if assert.NoError(t, srv.TakeIn(e.NewContext(req, rec))) {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, c.expectedConnections, sender.connections)
+
+				resp := response{}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.True(t, resp.Success)
+				if c.expectedDelivered > 0 && assert.NotNil(t, resp.Outcome) {
+					assert.Equal(t, c.expectedDelivered, resp.Outcome.Delivered)
+				}
+			}
+		})
+	}
+}
+
+type recordingSender struct {
+	mu          sync.Mutex
+	connections []string
+}
+
+func (rs *recordingSender) SendMessage(ctx context.Context, connections []string, msg interface{}) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.connections = append(rs.connections, connections...)
+	return nil
+}
+
+func TestStreamingPipeline(t *testing.T) {
+	testCases := []struct {
+		testName            string
+		getter              connectionGetter
+		expectedErr         error
+		expectedConnections []string
+	}{
+		{
+			testName:            "StreamedCase",
+			getter:              pagesGetter{pages: [][]string{{"conn-1", "conn-2"}, {"conn-3"}}},
+			expectedConnections: []string{"conn-1", "conn-2", "conn-3"},
+		},
+		{
+			testName:            "LookupFailureCase",
+			getter:              pagesGetter{pages: [][]string{{"conn-1"}}, err: errors.New("scan failed")},
+			expectedErr:         errors.New("scan failed"),
+			expectedConnections: []string{"conn-1"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			sender := &streamingSender{}
+			srv := New(c.getter, sender)
+
+			err := srv.apigateway(context.Background(), incomeMessage{EventSubdomain: "el-show-de-producto-online"}, defaultTimeouts)
+			assert.Equal(t, c.expectedErr, err)
+			assert.Equal(t, c.expectedConnections, sender.connections)
+		})
+	}
+}
+
+type pagesGetter struct {
+	connGetter
+	pages [][]string
+	err   error
+}
+
+func (pg pagesGetter) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error {
+	for _, page := range pg.pages {
+		records := make([]store.Connection, 0, len(page))
+		for _, id := range page {
+			records = append(records, store.Connection{ConnectionID: id, EventSubdomain: subdomain})
+		}
+		pages <- records
+	}
+	return pg.err
+}
+
+type streamingSender struct {
+	recordingSender
+}
+
+func (ss *streamingSender) SendStream(ctx context.Context, pages <-chan []string, msg interface{}) error {
+	for page := range pages {
+		ss.connections = append(ss.connections, page...)
+	}
+	return nil
+}
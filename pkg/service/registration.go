@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRegistrationTTL = 30 * time.Second
+	defaultExpireInterval  = 10 * time.Second
+	defaultServerType      = "chat"
+	maxPort                = 65535
+)
+
+var (
+	errInvalidServerIP   = errors.New("invalid chat server ip")
+	errInvalidServerPort = errors.New("invalid chat server port")
+	errNoRegistrar       = errors.New("chat server registration is disabled")
+)
+
+type serverRegistrar interface {
+	RegisterServer(server store.ServerRegistration) error
+	HeartbeatServer(ip string, port int, expiresAt time.Time) error
+	DeregisterServer(ip string, port int) error
+	DeleteExpiredServers(now time.Time) (int, error)
+}
+
+type registrationResponse struct {
+	Success   bool      `json:"success"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// RegisterServer registers a chat server, it must send heartbeats before the registration expires
+func (s service) RegisterServer(c echo.Context) error {
+	if s.registrar == nil {
+		return c.JSON(http.StatusNotFound, registrationResponse{Error: errNoRegistrar.Error()})
+	}
+
+	server := store.ServerRegistration{}
+
+	if err := c.Bind(&server); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("unable to decode registration")
+		return c.JSON(http.StatusBadRequest, registrationResponse{Error: err.Error()})
+	}
+
+	if err := validateServer(server.IP, server.Port); err != nil {
+		return c.JSON(http.StatusBadRequest, registrationResponse{Error: err.Error()})
+	}
+
+	if len(server.ServerType) == 0 {
+		server.ServerType = defaultServerType
+	}
+	server.ExpiresAt = time.Now().Add(s.registrationTTL)
+
+	if err := s.registrar.RegisterServer(server); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"ip":    server.IP,
+		}).Error("unable to register chat server")
+		return c.JSON(http.StatusInternalServerError, registrationResponse{Error: err.Error()})
+	}
+
+	log.WithFields(log.Fields{
+		"ip":          server.IP,
+		"port":        server.Port,
+		"server_type": server.ServerType,
+		"region":      server.Region,
+		"events":      server.Events,
+	}).Info("chat server registered")
+	s.refreshRegistry()
+
+	return c.JSON(http.StatusOK, registrationResponse{Success: true, ExpiresAt: server.ExpiresAt})
+}
+
+// HeartbeatServer extends a chat server registration, servers are told apart by ip and port
+func (s service) HeartbeatServer(c echo.Context) error {
+	if s.registrar == nil {
+		return c.JSON(http.StatusNotFound, registrationResponse{Error: errNoRegistrar.Error()})
+	}
+
+	server := store.ServerRegistration{}
+
+	if err := c.Bind(&server); err != nil {
+		return c.JSON(http.StatusBadRequest, registrationResponse{Error: err.Error()})
+	}
+
+	if err := validateServer(server.IP, server.Port); err != nil {
+		return c.JSON(http.StatusBadRequest, registrationResponse{Error: err.Error()})
+	}
+
+	expiresAt := time.Now().Add(s.registrationTTL)
+	err := s.registrar.HeartbeatServer(server.IP, server.Port, expiresAt)
+
+	if err == store.ErrServerNotRegistered {
+		return c.JSON(http.StatusNotFound, registrationResponse{Error: err.Error()})
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"server": server.Address(),
+		}).Error("unable to store chat server heartbeat")
+		return c.JSON(http.StatusInternalServerError, registrationResponse{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, registrationResponse{Success: true, ExpiresAt: expiresAt})
+}
+
+// DeregisterServer removes the registration of the chat server at ip and port
+func (s service) DeregisterServer(c echo.Context) error {
+	if s.registrar == nil {
+		return c.JSON(http.StatusNotFound, registrationResponse{Error: errNoRegistrar.Error()})
+	}
+
+	server := store.ServerRegistration{}
+
+	if err := c.Bind(&server); err != nil {
+		return c.JSON(http.StatusBadRequest, registrationResponse{Error: err.Error()})
+	}
+
+	if err := validateServer(server.IP, server.Port); err != nil {
+		return c.JSON(http.StatusBadRequest, registrationResponse{Error: err.Error()})
+	}
+
+	if err := s.registrar.DeregisterServer(server.IP, server.Port); err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"server": server.Address(),
+		}).Error("unable to deregister chat server")
+		return c.JSON(http.StatusInternalServerError, registrationResponse{Error: err.Error()})
+	}
+
+	log.WithFields(log.Fields{"server": server.Address()}).Info("chat server deregistered")
+	s.refreshRegistry()
+
+	return c.JSON(http.StatusOK, registrationResponse{Success: true})
+}
+
+// ExpireServers removes the chat servers whose heartbeat expired every interval, it never returns
+func (s service) ExpireServers(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultExpireInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.registrar.DeleteExpiredServers(time.Now())
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("unable to remove expired chat servers")
+		}
+
+		if deleted > 0 {
+			log.WithFields(log.Fields{"deleted": deleted}).Info("expired chat servers removed")
+			s.refreshRegistry()
+		}
+	}
+}
+
+func (s service) refreshRegistry() {
+	if s.registry != nil {
+		s.registry.Refresh()
+	}
+}
+
+func validateServer(ip string, port int) error {
+	if net.ParseIP(ip) == nil {
+		return errInvalidServerIP
+	}
+
+	if port <= 0 || port > maxPort {
+		return errInvalidServerPort
+	}
+
+	return nil
+}
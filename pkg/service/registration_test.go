@@ -0,0 +1,119 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerRegistration(t *testing.T) {
+	testCases := []struct {
+		testName               string
+		handler                func(service, echo.Context) error
+		requestPost            string
+		expectedHTTPStatusCode int
+		expectedRegistered     bool
+	}{
+		{
+			testName:               "RegisterCase",
+			handler:                service.RegisterServer,
+			requestPost:            `{"ip":"10.0.0.1","port":8080,"capacity":5000,"events":["el-show-de-producto-online"]}`,
+			expectedHTTPStatusCode: http.StatusOK,
+			expectedRegistered:     true,
+		},
+		{
+			testName:               "RegisterInvalidPortCase",
+			handler:                service.RegisterServer,
+			requestPost:            `{"ip":"10.0.0.1","port":0}`,
+			expectedHTTPStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "RegisterInvalidIPCase",
+			handler:                service.RegisterServer,
+			requestPost:            `{"ip":"chat-1","port":8080}`,
+			expectedHTTPStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "HeartbeatCase",
+			handler:                service.HeartbeatServer,
+			requestPost:            `{"ip":"10.0.0.2","port":8080}`,
+			expectedHTTPStatusCode: http.StatusOK,
+		},
+		{
+			testName:               "HeartbeatUnknownServerCase",
+			handler:                service.HeartbeatServer,
+			requestPost:            `{"ip":"10.0.0.2","port":8081}`,
+			expectedHTTPStatusCode: http.StatusNotFound,
+		},
+		{
+			testName:               "HeartbeatWithoutPortCase",
+			handler:                service.HeartbeatServer,
+			requestPost:            `{"ip":"10.0.0.2"}`,
+			expectedHTTPStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "DeregisterCase",
+			handler:                service.DeregisterServer,
+			requestPost:            `{"ip":"10.0.0.2","port":8080}`,
+			expectedHTTPStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range testCases {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/chat-servers/", strings.NewReader(c.requestPost))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		context := e.NewContext(req, rec)
+
+		registrar := &serverRegistrarMock{registered: map[string]store.ServerRegistration{
+			"10.0.0.2:8080": {IP: "10.0.0.2", Port: 8080},
+		}}
+		srv := New(connGetter{}, msgSender{}, WithServerRegistrar(registrar, time.Minute))
+
+		t.Run(c.testName, func(t *testing.T) {
+			if assert.NoError(t, c.handler(srv, context)) {
+				assert.Equal(t, c.expectedHTTPStatusCode, rec.Code)
+				if c.expectedRegistered {
+					assert.Equal(t, "chat", registrar.registered["10.0.0.1:8080"].ServerType)
+					assert.True(t, registrar.registered["10.0.0.1:8080"].ExpiresAt.After(time.Now()))
+				}
+			}
+		})
+	}
+}
+
+type serverRegistrarMock struct {
+	registered map[string]store.ServerRegistration
+}
+
+func (rm *serverRegistrarMock) RegisterServer(server store.ServerRegistration) error {
+	rm.registered[server.Address()] = server
+	return nil
+}
+
+func (rm *serverRegistrarMock) HeartbeatServer(ip string, port int, expiresAt time.Time) error {
+	address := store.Address(ip, port)
+	server, exists := rm.registered[address]
+	if !exists {
+		return store.ErrServerNotRegistered
+	}
+	server.ExpiresAt = expiresAt
+	rm.registered[address] = server
+	return nil
+}
+
+func (rm *serverRegistrarMock) DeregisterServer(ip string, port int) error {
+	delete(rm.registered, store.Address(ip, port))
+	return nil
+}
+
+func (rm *serverRegistrarMock) DeleteExpiredServers(now time.Time) (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RoutingBroadcast sends every message to every chat server
+	RoutingBroadcast = "broadcast"
+	// RoutingRegistration sends messages to the servers registered as hosting the event
+	RoutingRegistration = "registration"
+	// RoutingHash sends messages to the servers picked by consistent hashing of the event subdomain
+	RoutingHash = "hash"
+
+	defaultRoutingReplicas     = 2
+	defaultRoutingVirtualNodes = 100
+)
+
+// RoutingSettings holds how chat-server-v2 messages are routed to chat servers
+type RoutingSettings struct {
+	Mode string
+	// Replicas is the number of servers picked per event in hash mode
+	Replicas int
+	// VirtualNodes is the number of ring points per server in hash mode
+	VirtualNodes int
+}
+
+type ringPoint struct {
+	hash    uint32
+	address string
+	server  int
+}
+
+// routeServers returns the servers of serverType hosting subdomain, falling back to
+// broadcast when the mapping is unknown
+func (s service) routeServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	switch s.routing.Mode {
+	case RoutingRegistration:
+		servers, err := s.servers.GetEventServers(ctx, serverType, subdomain)
+		if err != nil {
+			return nil, err
+		}
+		if len(servers) > 0 {
+			return servers, nil
+		}
+
+	case RoutingHash:
+		servers, err := s.servers.GetServerConnections(ctx, serverType)
+		if err != nil {
+			return nil, err
+		}
+		if routed := hashServers(subdomain, servers, s.routing.Replicas, s.routing.VirtualNodes); len(routed) > 0 {
+			return routed, nil
+		}
+		return servers, nil
+
+	case RoutingBroadcast, "":
+		return s.allServers(ctx, serverType)
+
+	default:
+		log.WithFields(log.Fields{"routing": s.routing.Mode}).Warn("unknown routing mode")
+	}
+
+	log.WithFields(log.Fields{
+		"event_subdomain": subdomain,
+		"routing":         s.routing.Mode,
+		"server_type":     serverType,
+	}).Info("event servers unknown, broadcasting")
+
+	return s.allServers(ctx, serverType)
+}
+
+func (s service) allServers(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	return s.servers.GetServerConnections(ctx, serverType)
+}
+
+// hashServers picks replicas servers for subdomain walking a ring of FNV-1a hashes
+// of "<ip>:<port>-<n>" virtual nodes
+func hashServers(subdomain string, servers []store.ChatServer, replicas, virtualNodes int) []store.ChatServer {
+	if replicas <= 0 {
+		replicas = defaultRoutingReplicas
+	}
+	if virtualNodes <= 0 {
+		virtualNodes = defaultRoutingVirtualNodes
+	}
+
+	ring := make([]ringPoint, 0, len(servers)*virtualNodes)
+	for idx, server := range servers {
+		address := server.Address()
+		for n := 0; n < virtualNodes; n++ {
+			ring = append(ring, ringPoint{
+				hash:    hashKey(fmt.Sprintf("%s-%d", address, n)),
+				address: address,
+				server:  idx,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash == ring[j].hash {
+			return ring[i].address < ring[j].address
+		}
+		return ring[i].hash < ring[j].hash
+	})
+
+	routed := make([]store.ChatServer, 0, replicas)
+	if len(ring) == 0 {
+		return routed
+	}
+
+	key := hashKey(subdomain)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= key })
+
+	picked := make(map[string]bool, replicas)
+	for i := 0; i < len(ring) && len(routed) < replicas; i++ {
+		point := ring[(start+i)%len(ring)]
+		if picked[point.address] {
+			continue
+		}
+		picked[point.address] = true
+		routed = append(routed, servers[point.server])
+	}
+
+	return routed
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
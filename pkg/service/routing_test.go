@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashServers(t *testing.T) {
+	servers := []store.ChatServer{
+		{IP: "10.0.0.1", Port: 8080},
+		{IP: "10.0.0.1", Port: 8081},
+		{IP: "10.0.0.2", Port: 8080},
+		{IP: "10.0.0.3", Port: 8080},
+	}
+
+	routed := hashServers("el-show-de-producto-online", servers, 2, 50)
+	assert.Len(t, routed, 2)
+	assert.Equal(t, routed, hashServers("el-show-de-producto-online", servers, 2, 50))
+	assert.NotEqual(t, routed[0].Address(), routed[1].Address())
+	assert.Subset(t, servers, routed)
+
+	// servers sharing a host are distinct ring members
+	assert.ElementsMatch(t, servers, hashServers("other-event", servers, 10, 50))
+	assert.Empty(t, hashServers("other-event", nil, 2, 50))
+}
+
+func TestRouteServers(t *testing.T) {
+	testCases := []struct {
+		testName        string
+		mode            string
+		eventServers    []store.ChatServer
+		expectedServers int
+	}{
+		{
+			testName:        "BroadcastCase",
+			mode:            RoutingBroadcast,
+			eventServers:    []store.ChatServer{{IP: "10.0.0.1", Port: 8080}},
+			expectedServers: 3,
+		},
+		{
+			testName:        "RegistrationCase",
+			mode:            RoutingRegistration,
+			eventServers:    []store.ChatServer{{IP: "10.0.0.1", Port: 8080}},
+			expectedServers: 1,
+		},
+		{
+			testName:        "RegistrationUnknownFallbackCase",
+			mode:            RoutingRegistration,
+			eventServers:    []store.ChatServer{},
+			expectedServers: 3,
+		},
+		{
+			testName:        "HashCase",
+			mode:            RoutingHash,
+			expectedServers: 2,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			getter := connGetter{
+				servers: []store.ChatServer{
+					{IP: "10.0.0.1", Port: 8080},
+					{IP: "10.0.0.2", Port: 8080},
+					{IP: "10.0.0.2", Port: 8081},
+				},
+				eventServers: c.eventServers,
+			}
+			srv := New(getter, msgSender{}, WithRouting(RoutingSettings{Mode: c.mode, Replicas: 2}))
+
+			servers, err := srv.routeServers(context.Background(), "chat", "el-show-de-producto-online")
+			if assert.NoError(t, err) {
+				assert.Len(t, servers, c.expectedServers)
+			}
+		})
+	}
+}
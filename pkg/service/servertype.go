@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+)
+
+const (
+	// PayloadFull publishes the whole income message
+	PayloadFull = "full"
+	// PayloadMessage publishes only the message field of the income message
+	PayloadMessage = "message"
+
+	defaultServerScheme = "http"
+	defaultServerPath   = "/publish/chat/"
+)
+
+// ServerType describes how messages of a gateway type are published to a kind of server
+type ServerType struct {
+	Name        string
+	GatewayType string
+	Scheme      string
+	Path        string
+	Payload     string
+	// EnvelopeKey wraps the payload as {"<EnvelopeKey>": payload} when set
+	EnvelopeKey string
+	// EnvelopeFields are added next to the envelope key
+	EnvelopeFields map[string]interface{}
+}
+
+// DefaultServerTypes returns the chat server type used when none is configured
+func DefaultServerTypes() []ServerType {
+	return []ServerType{
+		{
+			Name:        defaultServerType,
+			GatewayType: neermeChat,
+			Scheme:      defaultServerScheme,
+			Path:        defaultServerPath,
+			Payload:     PayloadFull,
+		},
+	}
+}
+
+func (st ServerType) publishURL(ip string, port int) string {
+	return fmt.Sprintf("%s://%s%s", st.scheme(), store.Address(ip, port), st.Path)
+}
+
+func (st ServerType) scheme() string {
+	if len(st.Scheme) == 0 {
+		return defaultServerScheme
+	}
+	return st.Scheme
+}
+
+func (st ServerType) payload(msg incomeMessage) ([]byte, error) {
+	var content interface{} = msg
+	if st.Payload == PayloadMessage {
+		content = msg.Message
+	}
+
+	if len(st.EnvelopeKey) == 0 {
+		return json.Marshal(content)
+	}
+
+	envelope := make(map[string]interface{}, len(st.EnvelopeFields)+1)
+	for key, value := range st.EnvelopeFields {
+		envelope[key] = value
+	}
+	envelope[st.EnvelopeKey] = content
+
+	return json.Marshal(envelope)
+}
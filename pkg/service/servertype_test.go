@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTypePayload(t *testing.T) {
+	msg := incomeMessage{
+		EventSubdomain: "el-show-de-producto-online",
+		AudienceType:   "attendance",
+		GatewayType:    "reactions",
+		Message:        map[string]interface{}{"emoji": "clap"},
+	}
+
+	testCases := []struct {
+		testName        string
+		serverType      ServerType
+		expectedPayload string
+	}{
+		{
+			testName:        "FullCase",
+			serverType:      ServerType{Payload: PayloadFull},
+			expectedPayload: `{"event_subdomain":"el-show-de-producto-online","audience_type":"attendance","gateway_type":"reactions","message":{"emoji":"clap"}}`,
+		},
+		{
+			testName:        "MessageCase",
+			serverType:      ServerType{Payload: PayloadMessage},
+			expectedPayload: `{"emoji":"clap"}`,
+		},
+		{
+			testName: "EnvelopeCase",
+			serverType: ServerType{
+				Payload:        PayloadMessage,
+				EnvelopeKey:    "data",
+				EnvelopeFields: map[string]interface{}{"type": "reaction"},
+			},
+			expectedPayload: `{"data":{"emoji":"clap"},"type":"reaction"}`,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			payload, err := c.serverType.payload(msg)
+			if assert.NoError(t, err) {
+				assert.JSONEq(t, c.expectedPayload, string(payload))
+			}
+		})
+	}
+}
+
+func TestServerTypePublishURL(t *testing.T) {
+	assert.Equal(t, "http://10.0.0.1:8080/publish/chat/", DefaultServerTypes()[0].publishURL("10.0.0.1", 8080))
+	assert.Equal(t, "https://10.0.0.1:8443/publish/qa/", ServerType{Scheme: "https", Path: "/publish/qa/"}.publishURL("10.0.0.1", 8443))
+	assert.Equal(t, "http://[fd00::1]:8080/publish/chat/", DefaultServerTypes()[0].publishURL("fd00::1", 8080))
+}
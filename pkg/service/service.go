@@ -1,24 +1,223 @@
 package service
 
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/breaker"
+	"github.com/boletia/ws-message-dispatcher/pkg/health"
+	"github.com/boletia/ws-message-dispatcher/pkg/ratelimit"
+	"github.com/boletia/ws-message-dispatcher/pkg/reaper"
+	"github.com/boletia/ws-message-dispatcher/pkg/registry"
+	"github.com/boletia/ws-message-dispatcher/pkg/reload"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+)
+
 // UserStorage get users from storage
 type connectionGetter interface {
-	GetUserConnections(eventSubdomain string, audienceType string, connections *[]string) error
-	GetServerConnections(servers map[string]int) error
+	GetUserConnections(ctx context.Context, eventSubdomain string, audienceType string, connections *[]store.Connection) error
+	GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error)
+	GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error)
+}
+
+// connectionStreamer is implemented by the stores able to yield connections per page
+type connectionStreamer interface {
+	StreamUserConnections(ctx context.Context, eventSubdomain string, audienceType string, pages chan<- []store.Connection) error
+}
+
+type serverGetter interface {
+	GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error)
+	GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error)
+}
+
+type serverRegistry interface {
+	serverGetter
+	Refresh()
+	Status() registry.Status
+}
+
+type connectionInvalidator interface {
+	Invalidate(subdomain string)
+	InvalidateAll()
+}
+
+type connectionCache interface {
+	connectionGetter
+	connectionInvalidator
+}
+
+type connectionReaper interface {
+	Trigger()
+	Status() reaper.Status
+}
+
+type configReloader interface {
+	Trigger()
+	Status() reload.Status
 }
 
 type messageSender interface {
-	SendMessage(connections []string, msg interface{})
+	SendMessage(ctx context.Context, connections []string, msg interface{}) error
+}
+
+// messageStreamer is implemented by the senders able to send while connections are resolved
+type messageStreamer interface {
+	SendStream(ctx context.Context, pages <-chan []string, msg interface{}) error
 }
 
 type service struct {
-	dbUser connectionGetter
-	sender messageSender
+	dbUser     connectionGetter
+	sender     messageSender
+	breakers   *breaker.Set
+	chatClient *http.Client
+	health     *health.Tracker
+	routing    RoutingSettings
+	servers    serverGetter
+	registry   serverRegistry
+
+	invalidator connectionInvalidator
+	reaper      connectionReaper
+	reloader    configReloader
+
+	eventConfigs eventConfigGetter
+	limiter      *ratelimit.Set
+
+	registrar       serverRegistrar
+	registrationTTL time.Duration
+
+	// serverTypes indexed by gateway type
+	serverTypes map[string]ServerType
+	// serverTypeClients indexed by server type name, chatClient is used for the rest
+	serverTypeClients map[string]*http.Client
+
+	timeouts        Timeouts
+	gatewayTimeouts map[string]Timeouts
+}
+
+// Option configures optional service dependencies
+type Option func(*service)
+
+// WithBreakers sets the circuit breakers used for chat servers
+func WithBreakers(breakers *breaker.Set) Option {
+	return func(s *service) {
+		s.breakers = breakers
+	}
+}
+
+// WithChatClient sets the pooled http client used for chat servers
+func WithChatClient(client *http.Client) Option {
+	return func(s *service) {
+		s.chatClient = client
+	}
+}
+
+// WithHealth sets the chat servers health tracker
+func WithHealth(tracker *health.Tracker) Option {
+	return func(s *service) {
+		s.health = tracker
+	}
+}
+
+// WithRouting sets how chat-server-v2 messages are routed to chat servers
+func WithRouting(settings RoutingSettings) Option {
+	return func(s *service) {
+		s.routing = settings
+	}
+}
+
+// WithServerRegistry serves chat servers from reg instead of reading the store on every message
+func WithServerRegistry(reg serverRegistry) Option {
+	return func(s *service) {
+		s.servers = reg
+		s.registry = reg
+	}
+}
+
+// WithConnectionCache reads user connections through cache and enables the connections
+// invalidation endpoint
+func WithConnectionCache(cache connectionCache) Option {
+	return func(s *service) {
+		s.dbUser = cache
+		s.invalidator = cache
+	}
+}
+
+// WithReaper enables the stale connections reaper endpoints
+func WithReaper(r connectionReaper) Option {
+	return func(s *service) {
+		s.reaper = r
+	}
+}
+
+// WithReloader enables the config reload endpoints
+func WithReloader(r configReloader) Option {
+	return func(s *service) {
+		s.reloader = r
+	}
+}
+
+// WithEventConfigs applies the per event dispatch settings of configs
+func WithEventConfigs(configs eventConfigGetter) Option {
+	return func(s *service) {
+		s.eventConfigs = configs
+	}
+}
+
+// WithServerRegistrar enables chat server self-registration, registrations expire after ttl
+// without heartbeats
+func WithServerRegistrar(registrar serverRegistrar, ttl time.Duration) Option {
+	return func(s *service) {
+		s.registrar = registrar
+		s.registrationTTL = ttl
+		if ttl <= 0 {
+			s.registrationTTL = defaultRegistrationTTL
+		}
+	}
+}
+
+// WithServerTypes sets the server types messages can be published to
+func WithServerTypes(serverTypes []ServerType) Option {
+	return func(s *service) {
+		s.serverTypes = indexServerTypes(serverTypes)
+	}
+}
+
+// WithServerTypeClient sets the http client used for the servers of serverType
+func WithServerTypeClient(serverType string, client *http.Client) Option {
+	return func(s *service) {
+		s.serverTypeClients[serverType] = client
+	}
+}
+
+func indexServerTypes(serverTypes []ServerType) map[string]ServerType {
+	index := make(map[string]ServerType, len(serverTypes))
+	for _, st := range serverTypes {
+		index[st.GatewayType] = st
+	}
+	return index
 }
 
 // New creates new service
-func New(dbUser connectionGetter, sender messageSender) service {
-	return service{
-		dbUser: dbUser,
-		sender: sender,
+func New(dbUser connectionGetter, sender messageSender, options ...Option) service {
+	srv := service{
+		dbUser:     dbUser,
+		sender:     sender,
+		breakers:   breaker.New(breaker.Settings{}),
+		chatClient: NewChatClient(ChatTransportSettings{}),
+		health:     health.New(health.Settings{}),
+		routing:    RoutingSettings{Mode: RoutingBroadcast},
+		servers:    dbUser,
+		limiter:    ratelimit.New(),
+
+		serverTypes:       indexServerTypes(DefaultServerTypes()),
+		serverTypeClients: make(map[string]*http.Client),
+		timeouts:          defaultTimeouts,
+	}
+
+	for _, opt := range options {
+		opt(&srv)
 	}
+
+	return srv
 }
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	stageLookup = "lookup"
+	stageSend   = "send"
+)
+
+var defaultTimeouts = Timeouts{
+	Lookup:  5 * time.Second,
+	Send:    5 * time.Second,
+	Overall: 15 * time.Second,
+}
+
+// Timeouts holds the deadlines of each dispatch stage, zero values fall back to defaults
+type Timeouts struct {
+	Lookup  time.Duration
+	Send    time.Duration
+	Overall time.Duration
+}
+
+// WithTimeouts sets the dispatch deadlines, perGateway overrides defaults by gateway type
+func WithTimeouts(defaults Timeouts, perGateway map[string]Timeouts) Option {
+	return func(s *service) {
+		s.timeouts = defaults.orDefault(defaultTimeouts)
+		s.gatewayTimeouts = perGateway
+	}
+}
+
+func (s service) timeoutsFor(gatewayType string) Timeouts {
+	if timeouts, exists := s.gatewayTimeouts[gatewayType]; exists {
+		return timeouts.orDefault(s.timeouts)
+	}
+	return s.timeouts
+}
+
+func (t Timeouts) orDefault(defaults Timeouts) Timeouts {
+	if t.Lookup <= 0 {
+		t.Lookup = defaults.Lookup
+	}
+	if t.Send <= 0 {
+		t.Send = defaults.Send
+	}
+	if t.Overall <= 0 {
+		t.Overall = defaults.Overall
+	}
+	return t
+}
+
+// timedOut reports whether err was caused by ctx running out of time
+func timedOut(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded
+}
+
+func logTimeout(msg incomeMessage, stage string, timeout time.Duration) {
+	chatMetrics.Add("timeouts", 1)
+	log.WithFields(log.Fields{
+		"event_subdomain": msg.EventSubdomain,
+		"gateway_type":    msg.GatewayType,
+		"stage":           stage,
+		"timeout":         timeout,
+	}).Error("dispatch timed out")
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutsFor(t *testing.T) {
+	srv := New(connGetter{}, msgSender{}, WithTimeouts(
+		Timeouts{Lookup: time.Second},
+		map[string]Timeouts{neermeChat: {Send: 2 * time.Second}},
+	))
+
+	assert.Equal(t, Timeouts{Lookup: time.Second, Send: defaultTimeouts.Send, Overall: defaultTimeouts.Overall}, srv.timeoutsFor(apiGatewayChat))
+	assert.Equal(t, Timeouts{Lookup: time.Second, Send: 2 * time.Second, Overall: defaultTimeouts.Overall}, srv.timeoutsFor(neermeChat))
+}
+
+func TestDispatchTimesOut(t *testing.T) {
+	chatServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+	}))
+	defer chatServer.Close()
+
+	ip, port := splitHostPort(t, chatServer.Listener.Addr().String())
+	timeouts := Timeouts{Lookup: time.Second, Send: 50 * time.Millisecond, Overall: time.Second}
+
+	testCases := []struct {
+		testName string
+		msg      incomeMessage
+		sender   messageSender
+	}{
+		{
+			testName: "ChatServerSendCase",
+			msg:      incomeMessage{EventSubdomain: "el-show-de-producto-online", GatewayType: neermeChat},
+			sender:   msgSender{},
+		},
+		{
+			testName: "ApiGatewaySendCase",
+			msg:      incomeMessage{EventSubdomain: "el-show-de-producto-online", GatewayType: apiGatewayChat},
+			sender:   slowSender{},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			srv := New(connGetter{servers: []store.ChatServer{{IP: ip, Port: port, ServerType: "chat"}}}, c.sender, WithTimeouts(timeouts, nil))
+
+			outcome, err := srv.dispatchMessage(context.Background(), c.msg)
+			assert.Equal(t, context.DeadlineExceeded, err)
+			if outcome != nil {
+				assert.True(t, outcome.TimedOut)
+			}
+		})
+	}
+}
+
+type slowSender struct{}
+
+func (ss slowSender) SendMessage(ctx context.Context, connections []string, msg interface{}) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+var cacheMetrics = expvar.NewMap("connection_cache")
+
+type connectionGetter interface {
+	GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error
+	StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error
+	GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error)
+	GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error)
+}
+
+type key struct {
+	subdomain    string
+	audienceType string
+}
+
+type entry struct {
+	ready       chan struct{}
+	connections []store.Connection
+	err         error
+	expiresAt   time.Time
+}
+
+// Cache keeps user connections per subdomain and audience for a short ttl, server lookups
+// go straight to the wrapped getter
+type Cache struct {
+	connectionGetter
+	ttl time.Duration
+	// timeout bounds the shared lookups, they don't run on the context of any caller so
+	// one caller giving up doesn't fail the rest
+	timeout time.Duration
+
+	mu      sync.Mutex
+	entries map[key]*entry
+}
+
+// New wraps getter with a connections cache, timeout bounds each lookup to getter
+func New(getter connectionGetter, ttl time.Duration, timeout time.Duration) *Cache {
+	return &Cache{
+		connectionGetter: getter,
+		ttl:              ttl,
+		timeout:          timeout,
+		entries:          make(map[key]*entry),
+	}
+}
+
+// GetUserConnections serves connections from cache, concurrent misses of the same key share
+// a single lookup
+func (c *Cache) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error {
+	k := key{subdomain: subdomain, audienceType: audienceType}
+
+	e, leader := c.acquire(k)
+	if leader {
+		go func() {
+			loadCtx, cancel := c.loadContext()
+			defer cancel()
+
+			var loaded []store.Connection
+			err := c.connectionGetter.GetUserConnections(loadCtx, subdomain, audienceType, &loaded)
+			c.complete(k, e, loaded, err)
+		}()
+	}
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	*connections = append(*connections, e.connections...)
+	return nil
+}
+
+// Invalidate drops the cached connections of every audience of subdomain
+func (c *Cache) Invalidate(subdomain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if k.subdomain == subdomain {
+			delete(c.entries, k)
+		}
+	}
+
+	log.WithFields(log.Fields{"event_subdomain": subdomain}).Debug("connections cache invalidated")
+}
+
+// InvalidateAll drops every cached connection
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[key]*entry)
+}
+
+// StreamUserConnections sends cached connections as a single page, on a miss the pages of
+// the wrapped store are forwarded and cached once the stream completes
+func (c *Cache) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error {
+	k := key{subdomain: subdomain, audienceType: audienceType}
+
+	e, leader := c.acquire(k)
+	if leader {
+		return c.forward(ctx, k, e, pages)
+	}
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.connections) == 0 {
+		return nil
+	}
+
+	page := make([]store.Connection, len(e.connections))
+	copy(page, e.connections)
+
+	select {
+	case pages <- page:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forward sends the pages of the shared lookup to pages while ctx lasts, the lookup goes on
+// after ctx is done so the entry is completed for the callers waiting on it
+func (c *Cache) forward(ctx context.Context, k key, e *entry, pages chan<- []store.Connection) error {
+	inner := make(chan []store.Connection)
+	forwarded := make(chan []store.Connection)
+
+	go func() {
+		loadCtx, cancel := c.loadContext()
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- c.connectionGetter.StreamUserConnections(loadCtx, k.subdomain, k.audienceType, inner)
+			close(inner)
+		}()
+
+		var loaded []store.Connection
+		forwarding := true
+		for page := range inner {
+			loaded = append(loaded, page...)
+			if !forwarding {
+				continue
+			}
+
+			select {
+			case forwarded <- page:
+			case <-ctx.Done():
+				forwarding = false
+			}
+		}
+
+		c.complete(k, e, loaded, <-done)
+		close(forwarded)
+	}()
+
+	for page := range forwarded {
+		select {
+		case pages <- page:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return e.err
+}
+
+// loadContext bounds a shared lookup by the cache timeout instead of the context of a caller
+func (c *Cache) loadContext() (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// acquire gets the entry of k, leader is true when the caller must load it
+func (c *Cache) acquire(k key) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, exists := c.entries[k]
+	if exists && !e.isExpired() {
+		cacheMetrics.Add("hits", 1)
+		return e, false
+	}
+
+	cacheMetrics.Add("misses", 1)
+	e = &entry{ready: make(chan struct{})}
+	c.entries[k] = e
+	return e, true
+}
+
+func (c *Cache) complete(k key, e *entry, connections []store.Connection, err error) {
+	c.mu.Lock()
+	e.connections = connections
+	e.err = err
+	e.expiresAt = time.Now().Add(c.ttl)
+	if err != nil && c.entries[k] == e {
+		delete(c.entries, k)
+	}
+	c.mu.Unlock()
+
+	close(e.ready)
+}
+
+func (e *entry) isExpired() bool {
+	select {
+	case <-e.ready:
+		return time.Now().After(e.expiresAt)
+	default:
+		return false
+	}
+}
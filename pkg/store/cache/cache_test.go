@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingGetter struct {
+	lookups int32
+	delay   time.Duration
+	err     error
+}
+
+func (cg *countingGetter) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error {
+	atomic.AddInt32(&cg.lookups, 1)
+	time.Sleep(cg.delay)
+	if cg.err != nil {
+		return cg.err
+	}
+	*connections = append(*connections, store.Connection{ConnectionID: subdomain + "-" + audienceType, EventSubdomain: subdomain})
+	return nil
+}
+
+func (cg *countingGetter) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error {
+	atomic.AddInt32(&cg.lookups, 1)
+	if cg.err != nil {
+		return cg.err
+	}
+	pages <- []store.Connection{{ConnectionID: subdomain + "-1", EventSubdomain: subdomain}}
+	pages <- []store.Connection{{ConnectionID: subdomain + "-2", EventSubdomain: subdomain}}
+	return nil
+}
+
+func (cg *countingGetter) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	return nil, nil
+}
+
+func (cg *countingGetter) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	return nil, nil
+}
+
+func TestCacheSharesConcurrentLookups(t *testing.T) {
+	getter := &countingGetter{delay: 20 * time.Millisecond}
+	cache := New(getter, time.Minute, time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var connections []store.Connection
+			assert.NoError(t, cache.GetUserConnections(context.Background(), "show", "attendance", &connections))
+			assert.Equal(t, []string{"show-attendance"}, store.ConnectionIDs(connections))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&getter.lookups))
+}
+
+func TestCacheExpiresAndInvalidates(t *testing.T) {
+	getter := &countingGetter{}
+	cache := New(getter, 30*time.Millisecond, time.Second)
+	ctx := context.Background()
+	var connections []store.Connection
+
+	assert.NoError(t, cache.GetUserConnections(ctx, "show", "organizer", &connections))
+	assert.NoError(t, cache.GetUserConnections(ctx, "show", "organizer", &connections))
+	assert.Equal(t, int32(1), getter.lookups)
+
+	time.Sleep(40 * time.Millisecond)
+	assert.NoError(t, cache.GetUserConnections(ctx, "show", "organizer", &connections))
+	assert.Equal(t, int32(2), getter.lookups)
+
+	cache.Invalidate("show")
+	assert.NoError(t, cache.GetUserConnections(ctx, "show", "organizer", &connections))
+	assert.Equal(t, int32(3), getter.lookups)
+}
+
+func TestCacheDoesNotKeepErrors(t *testing.T) {
+	getter := &countingGetter{err: errors.New("throttled")}
+	cache := New(getter, time.Minute, time.Second)
+	var connections []store.Connection
+
+	assert.Error(t, cache.GetUserConnections(context.Background(), "show", "", &connections))
+	getter.err = nil
+	assert.NoError(t, cache.GetUserConnections(context.Background(), "show", "", &connections))
+	assert.Equal(t, int32(2), getter.lookups)
+}
+
+func TestCacheStreams(t *testing.T) {
+	getter := &countingGetter{}
+	cache := New(getter, time.Minute, time.Second)
+
+	for i := 0; i < 2; i++ {
+		pages := make(chan []store.Connection)
+		done := make(chan error, 1)
+		go func() {
+			done <- cache.StreamUserConnections(context.Background(), "show", "", pages)
+			close(pages)
+		}()
+
+		var connections []store.Connection
+		for page := range pages {
+			connections = append(connections, page...)
+		}
+
+		assert.NoError(t, <-done)
+		assert.Equal(t, []string{"show-1", "show-2"}, store.ConnectionIDs(connections))
+	}
+
+	assert.Equal(t, int32(1), getter.lookups)
+
+	var connections []store.Connection
+	assert.NoError(t, cache.GetUserConnections(context.Background(), "show", "", &connections))
+	assert.Equal(t, []string{"show-1", "show-2"}, store.ConnectionIDs(connections))
+	assert.Equal(t, int32(1), getter.lookups)
+}
+
+func TestCacheLookupOutlivesCancelledCaller(t *testing.T) {
+	getter := &countingGetter{delay: 30 * time.Millisecond}
+	cache := New(getter, time.Minute, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	cancelled := make(chan error, 1)
+	go func() {
+		var connections []store.Connection
+		cancelled <- cache.GetUserConnections(ctx, "show", "attendance", &connections)
+	}()
+	time.Sleep(time.Millisecond)
+
+	var connections []store.Connection
+	assert.NoError(t, cache.GetUserConnections(context.Background(), "show", "attendance", &connections))
+	assert.Equal(t, []string{"show-attendance"}, store.ConnectionIDs(connections))
+	assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&getter.lookups))
+}
+
+func TestCacheStreamOutlivesCancelledCaller(t *testing.T) {
+	getter := &countingGetter{}
+	cache := New(getter, time.Minute, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pages := make(chan []store.Connection)
+	done := make(chan error, 1)
+	go func() {
+		done <- cache.StreamUserConnections(ctx, "show", "", pages)
+	}()
+
+	<-pages
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	var connections []store.Connection
+	assert.NoError(t, cache.GetUserConnections(context.Background(), "show", "", &connections))
+	assert.Equal(t, []string{"show-1", "show-2"}, store.ConnectionIDs(connections))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&getter.lookups))
+}
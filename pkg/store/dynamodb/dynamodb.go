@@ -4,6 +4,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -13,47 +15,62 @@ type ConfigSetter interface {
 	GetUsersTable() (string, error)
 	GetServersTable() (string, error)
 	GetChatConfigTable() (string, error)
+	GetUsersIndex() string
+	GetScanSegments() int
+	GetConnectionAttributes() []string
 }
 
 type storage struct {
-	*dynamodb.DynamoDB
+	dynamodbiface.DynamoDBAPI
 	usersTable      string
 	serversTable    string
 	chatConfigTable string
+	usersIndex      string
+	segments        *segmenter
+	// connectionAttributes projected from the users table, see store.Projection
+	connectionAttributes []string
 }
 
-// New creates new dynamodb client
-func New(setter ConfigSetter) storage {
-	var region, usersTable, serversTable, chatConfigTable string
-	var err error
+// New creates new dynamodb client, it fails when a table or the region is missing
+func New(setter ConfigSetter) (storage, error) {
+	region, err := setter.GetDynamoRegion()
+	if err != nil {
+		return storage{}, err
+	}
 
-	if region, err = setter.GetDynamoRegion(); err != nil {
-		log.Fatalf("unable to read dynamo region:%s", err)
+	usersTable, err := setter.GetUsersTable()
+	if err != nil {
+		return storage{}, err
 	}
 
-	if usersTable, err = setter.GetUsersTable(); err != nil {
-		log.Fatalf("unable to read dynamo users table:%s", err)
+	serversTable, err := setter.GetServersTable()
+	if err != nil {
+		return storage{}, err
 	}
 
-	if serversTable, err = setter.GetServersTable(); err != nil {
-		log.Fatalf("unable to read dynamo servers table:%s", err)
+	chatConfigTable, err := setter.GetChatConfigTable()
+	if err != nil {
+		return storage{}, err
 	}
 
-	if chatConfigTable, err = setter.GetChatConfigTable(); err != nil {
-		log.Fatalf("unable to read dynamo chat config table:%s", err)
+	connectionAttributes, err := store.Projection(setter.GetConnectionAttributes())
+	if err != nil {
+		return storage{}, err
 	}
 
-	sess := session.Must(
-		session.NewSession(&aws.Config{
-			Region: &region},
-		),
-	)
-	dynamoDB := dynamodb.New(sess)
+	sess, err := session.NewSession(&aws.Config{Region: &region})
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("unable to create aws session")
+		return storage{}, err
+	}
 
 	return storage{
-		dynamoDB,
+		dynamodb.New(sess),
 		usersTable,
 		serversTable,
 		chatConfigTable,
-	}
+		setter.GetUsersIndex(),
+		newSegmenter(setter.GetScanSegments()),
+		connectionAttributes,
+	}, nil
 }
@@ -0,0 +1,42 @@
+package dynamodb
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+)
+
+var (
+	defaultGatewayLabel  = "default_gateway"
+	audiencesLabel       = "audiences"
+	rateLimitLabel       = "rate_limit"
+	rateBurstLabel       = "rate_burst"
+	maxMessageBytesLabel = "max_message_bytes"
+	mutedLabel           = "muted"
+	pausedLabel          = "paused"
+)
+
+// GetEventConfigs gets the dispatch settings of every event of the chat config table,
+// malformed items are skipped
+func (db storage) GetEventConfigs(ctx context.Context, configs map[string]store.EventConfig) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(db.chatConfigTable),
+	}
+
+	return db.ScanPagesWithContext(ctx, input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		db.appendEventConfigs(output.Items, configs)
+		return true
+	})
+}
+
+func (db storage) appendEventConfigs(items []map[string]*dynamodb.AttributeValue, configs map[string]store.EventConfig) {
+	for _, item := range items {
+		var record eventConfigRecord
+		if !unmarshalItem(db.chatConfigTable, eventSubdomainLabel, item, &record) {
+			continue
+		}
+		configs[record.EventSubdomain] = record.eventConfig()
+	}
+}
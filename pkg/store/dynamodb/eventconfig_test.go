@@ -0,0 +1,76 @@
+package dynamodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEventConfigs(t *testing.T) {
+	mock := &scanMock{pages: [][]map[string]*dynamodb.AttributeValue{
+		{
+			{
+				eventSubdomainLabel:  {S: aws.String("el-show-de-producto-online")},
+				defaultGatewayLabel:  {S: aws.String("chat-server-v2")},
+				audiencesLabel:       {SS: aws.StringSlice([]string{"attendance"})},
+				rateLimitLabel:       {N: aws.String("2.5")},
+				rateBurstLabel:       {N: aws.String("5")},
+				maxMessageBytesLabel: {N: aws.String("4096")},
+			},
+			{defaultGatewayLabel: {S: aws.String("api-gateway")}},
+		},
+		{
+			{
+				eventSubdomainLabel: {S: aws.String("otro-evento")},
+				mutedLabel:          {BOOL: aws.Bool(true)},
+				pausedLabel:         {BOOL: aws.Bool(true)},
+			},
+		},
+	}}
+	db := storage{DynamoDBAPI: mock, chatConfigTable: "chat-config"}
+
+	configs := map[string]store.EventConfig{}
+	if assert.NoError(t, db.GetEventConfigs(context.Background(), configs)) {
+		assert.Equal(t, map[string]store.EventConfig{
+			"el-show-de-producto-online": {
+				EventSubdomain:  "el-show-de-producto-online",
+				DefaultGateway:  "chat-server-v2",
+				Audiences:       []string{"attendance"},
+				RateLimit:       2.5,
+				RateBurst:       5,
+				MaxMessageBytes: 4096,
+			},
+			"otro-evento": {EventSubdomain: "otro-evento", Muted: true, Paused: true},
+		}, configs)
+	}
+
+	if assert.Len(t, mock.inputs, 1) {
+		assert.Equal(t, "chat-config", aws.StringValue(mock.inputs[0].TableName))
+	}
+}
+
+func TestGetEventConfigsSkipsMalformed(t *testing.T) {
+	mock := &scanMock{pages: [][]map[string]*dynamodb.AttributeValue{{
+		{
+			eventSubdomainLabel: {S: aws.String("el-show-de-producto-online")},
+			rateBurstLabel:      {N: aws.String("2.5")},
+		},
+		{
+			eventSubdomainLabel: {S: aws.String("otro-evento")},
+			pausedLabel:         {S: aws.String("true")},
+		},
+		{eventSubdomainLabel: {S: aws.String("sin-limites")}},
+	}}}
+	db := storage{DynamoDBAPI: mock, chatConfigTable: "malformed-chat-config"}
+	malformed := malformedCount("malformed-chat-config")
+
+	configs := map[string]store.EventConfig{}
+	if assert.NoError(t, db.GetEventConfigs(context.Background(), configs)) {
+		assert.Equal(t, map[string]store.EventConfig{"sin-limites": {EventSubdomain: "sin-limites"}}, configs)
+	}
+	assert.Equal(t, int64(2), malformedCount("malformed-chat-config")-malformed)
+}
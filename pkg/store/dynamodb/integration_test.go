@@ -0,0 +1,327 @@
+//go:build integration
+// +build integration
+
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// the integration suite runs against DynamoDB Local, start it with
+// `docker run -p 8000:8000 amazon/dynamodb-local` and run `make integration-test`
+const defaultLocalEndpoint = "http://localhost:8000"
+
+// localTables are the tables of a single test, dropped once it finishes
+type localTables struct {
+	client     dynamodbiface.DynamoDBAPI
+	users      string
+	servers    string
+	chatConfig string
+}
+
+func localClient(t *testing.T) dynamodbiface.DynamoDBAPI {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if len(endpoint) == 0 {
+		endpoint = defaultLocalEndpoint
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("local", "local", ""),
+	})
+	if err != nil {
+		t.Fatalf("unable to create dynamodb local session: %s", err)
+	}
+	return dynamodb.New(sess)
+}
+
+// createTables creates the users, servers and chat config tables named after t, the users
+// table gets the users index when withIndex is set
+func createTables(t *testing.T, client dynamodbiface.DynamoDBAPI, withIndex bool) localTables {
+	prefix := fmt.Sprintf("ws-dispatcher-%s-%d-", strings.NewReplacer("/", "-", " ", "-").Replace(t.Name()), time.Now().UnixNano())
+	tables := localTables{
+		client:     client,
+		users:      prefix + "users",
+		servers:    prefix + "servers",
+		chatConfig: prefix + "chat-config",
+	}
+
+	users := tableInput(tables.users, connectionIDLabel)
+	if withIndex {
+		users.AttributeDefinitions = append(users.AttributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(eventSubdomainLabel),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		})
+		users.GlobalSecondaryIndexes = []*dynamodb.GlobalSecondaryIndex{{
+			IndexName: aws.String(DefaultUsersIndex),
+			KeySchema: []*dynamodb.KeySchemaElement{{
+				AttributeName: aws.String(eventSubdomainLabel),
+				KeyType:       aws.String(dynamodb.KeyTypeHash),
+			}},
+			// every connection attribute is read from the index
+			Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+		}}
+	}
+
+	for _, input := range []*dynamodb.CreateTableInput{
+		users,
+		tableInput(tables.servers, serversIDLabel),
+		tableInput(tables.chatConfig, eventSubdomainLabel),
+	} {
+		if _, err := client.CreateTable(input); err != nil {
+			t.Fatalf("unable to create table %s: %s", aws.StringValue(input.TableName), err)
+		}
+
+		table := aws.StringValue(input.TableName)
+		t.Cleanup(func() {
+			if _, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(table)}); err != nil {
+				t.Errorf("unable to delete table %s: %s", table, err)
+			}
+		})
+
+		if err := client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: input.TableName}); err != nil {
+			t.Fatalf("table %s not created: %s", table, err)
+		}
+	}
+
+	return tables
+}
+
+func tableInput(table, hashKey string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName:   aws.String(table),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{
+			AttributeName: aws.String(hashKey),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}},
+		KeySchema: []*dynamodb.KeySchemaElement{{
+			AttributeName: aws.String(hashKey),
+			KeyType:       aws.String(dynamodb.KeyTypeHash),
+		}},
+	}
+}
+
+func (lt localTables) storage(usersIndex string, segments int) storage {
+	return storage{
+		DynamoDBAPI:          lt.client,
+		usersTable:           lt.users,
+		serversTable:         lt.servers,
+		chatConfigTable:      lt.chatConfig,
+		usersIndex:           usersIndex,
+		segments:             newSegmenter(segments),
+		connectionAttributes: store.ConnectionAttributes,
+	}
+}
+
+func (lt localTables) put(t *testing.T, table string, items ...map[string]*dynamodb.AttributeValue) {
+	for _, item := range items {
+		if _, err := lt.client.PutItem(&dynamodb.PutItemInput{TableName: aws.String(table), Item: item}); err != nil {
+			t.Fatalf("unable to seed table %s: %s", table, err)
+		}
+	}
+}
+
+func connectionItem(conn store.Connection) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		connectionIDLabel:   {S: aws.String(conn.ConnectionID)},
+		eventSubdomainLabel: {S: aws.String(conn.EventSubdomain)},
+		isOrganizerLabel:    {BOOL: aws.Bool(conn.IsOrganizer)},
+	}
+
+	if len(conn.UserID) > 0 {
+		item[store.AttrUserID] = &dynamodb.AttributeValue{S: aws.String(conn.UserID)}
+	}
+	if !conn.ConnectedAt.IsZero() {
+		item[store.AttrConnectedAt] = &dynamodb.AttributeValue{S: aws.String(conn.ConnectedAt.Format(time.RFC3339))}
+	}
+	if len(conn.Platform) > 0 {
+		item[store.AttrPlatform] = &dynamodb.AttributeValue{S: aws.String(conn.Platform)}
+	}
+	if len(conn.Language) > 0 {
+		item[store.AttrLanguage] = &dynamodb.AttributeValue{S: aws.String(conn.Language)}
+	}
+	if conn.Gone {
+		item[store.AttrGone] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+	}
+	return item
+}
+
+func eventConfigItem(config store.EventConfig) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		eventSubdomainLabel:  {S: aws.String(config.EventSubdomain)},
+		rateLimitLabel:       {N: aws.String(strconv.FormatFloat(config.RateLimit, 'f', -1, 64))},
+		rateBurstLabel:       {N: aws.String(strconv.Itoa(config.RateBurst))},
+		maxMessageBytesLabel: {N: aws.String(strconv.Itoa(config.MaxMessageBytes))},
+		mutedLabel:           {BOOL: aws.Bool(config.Muted)},
+		pausedLabel:          {BOOL: aws.Bool(config.Paused)},
+	}
+
+	if len(config.DefaultGateway) > 0 {
+		item[defaultGatewayLabel] = &dynamodb.AttributeValue{S: aws.String(config.DefaultGateway)}
+	}
+	if len(config.Audiences) > 0 {
+		item[audiencesLabel] = &dynamodb.AttributeValue{SS: aws.StringSlice(config.Audiences)}
+	}
+	return item
+}
+
+func localFactory(usersIndex string, segments int) storetest.Factory {
+	return func(t *testing.T, seed storetest.Seed) store.Store {
+		tables := createTables(t, localClient(t), len(usersIndex) > 0)
+
+		for _, conn := range seed.Connections {
+			tables.put(t, tables.users, connectionItem(conn))
+		}
+		for _, config := range seed.EventConfigs {
+			tables.put(t, tables.chatConfig, eventConfigItem(config))
+		}
+
+		return tables.storage(usersIndex, segments)
+	}
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, localFactory("", 1))
+}
+
+func TestStoreSegmented(t *testing.T) {
+	storetest.Run(t, localFactory("", 3))
+}
+
+func TestStoreUsersIndex(t *testing.T) {
+	storetest.Run(t, localFactory(DefaultUsersIndex, 1))
+}
+
+// pagedClient limits every scan and query page to limit items and counts the pages read
+type pagedClient struct {
+	dynamodbiface.DynamoDBAPI
+	limit int64
+
+	mu    sync.Mutex
+	pages int
+}
+
+func (pc *pagedClient) page() {
+	pc.mu.Lock()
+	pc.pages++
+	pc.mu.Unlock()
+}
+
+func (pc *pagedClient) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	limited := *input
+	limited.Limit = aws.Int64(pc.limit)
+	return pc.DynamoDBAPI.ScanPagesWithContext(ctx, &limited, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		pc.page()
+		return fn(output, lastPage)
+	}, opts...)
+}
+
+func (pc *pagedClient) QueryPagesWithContext(ctx aws.Context, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	limited := *input
+	limited.Limit = aws.Int64(pc.limit)
+	return pc.DynamoDBAPI.QueryPagesWithContext(ctx, &limited, func(output *dynamodb.QueryOutput, lastPage bool) bool {
+		pc.page()
+		return fn(output, lastPage)
+	}, opts...)
+}
+
+func TestPagination(t *testing.T) {
+	testCases := []struct {
+		testName   string
+		usersIndex string
+		segments   int
+	}{
+		{testName: "ScanCase", segments: 1},
+		{testName: "SegmentedScanCase", segments: 3},
+		{testName: "QueryCase", usersIndex: DefaultUsersIndex, segments: 1},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			tables := createTables(t, localClient(t), len(c.usersIndex) > 0)
+
+			expected := make([]string, 0, 30)
+			for i := 0; i < 30; i++ {
+				conn := store.Connection{
+					ConnectionID:   fmt.Sprintf("conn-%02d", i),
+					EventSubdomain: "el-show-de-producto-online",
+					IsOrganizer:    i%10 == 0,
+				}
+				tables.put(t, tables.users, connectionItem(conn))
+				expected = append(expected, conn.ConnectionID)
+			}
+			tables.put(t, tables.users, connectionItem(store.Connection{ConnectionID: "conn-other", EventSubdomain: "otro-evento"}))
+
+			client := &pagedClient{DynamoDBAPI: tables.client, limit: 4}
+			db := tables.storage(c.usersIndex, c.segments)
+			db.DynamoDBAPI = client
+
+			var connections []store.Connection
+			if assert.NoError(t, db.GetUserConnections(context.Background(), "el-show-de-producto-online", "", &connections)) {
+				assert.ElementsMatch(t, expected, store.ConnectionIDs(connections))
+			}
+			assert.True(t, client.pages >= 30/4, "read %d pages", client.pages)
+
+			connections = nil
+			if assert.NoError(t, db.GetUserConnections(context.Background(), "el-show-de-producto-online", "organizer", &connections)) {
+				assert.ElementsMatch(t, []string{"conn-00", "conn-10", "conn-20"}, store.ConnectionIDs(connections))
+			}
+		})
+	}
+}
+
+func TestMalformedItems(t *testing.T) {
+	tables := createTables(t, localClient(t), false)
+	subdomain := "el-show-de-producto-online"
+
+	tables.put(t, tables.users,
+		connectionItem(store.Connection{ConnectionID: "conn-valid", EventSubdomain: subdomain, IsOrganizer: true}),
+		map[string]*dynamodb.AttributeValue{
+			connectionIDLabel:     {S: aws.String("conn-malformed")},
+			eventSubdomainLabel:   {S: aws.String(subdomain)},
+			isOrganizerLabel:      {S: aws.String("true")},
+			store.AttrUserID:      {BOOL: aws.Bool(true)},
+			store.AttrConnectedAt: {S: aws.String("yesterday")},
+		},
+	)
+	tables.put(t, tables.chatConfig, map[string]*dynamodb.AttributeValue{
+		eventSubdomainLabel: {S: aws.String(subdomain)},
+		rateLimitLabel:      {S: aws.String("fast")},
+		audiencesLabel:      {S: aws.String("attendance")},
+	})
+
+	db := tables.storage("", 1)
+	malformedUsers, malformedConfigs := malformedCount(tables.users), malformedCount(tables.chatConfig)
+
+	// malformed items are skipped and counted instead of failing the lookup
+	var connections []store.Connection
+	if assert.NoError(t, db.GetUserConnections(context.Background(), subdomain, "", &connections)) {
+		assert.Equal(t, []store.Connection{{ConnectionID: "conn-valid", EventSubdomain: subdomain, IsOrganizer: true}}, connections)
+	}
+	assert.Equal(t, int64(1), malformedCount(tables.users)-malformedUsers)
+
+	configs := map[string]store.EventConfig{}
+	if assert.NoError(t, db.GetEventConfigs(context.Background(), configs)) {
+		assert.Empty(t, configs)
+	}
+	assert.Equal(t, int64(1), malformedCount(tables.chatConfig)-malformedConfigs)
+}
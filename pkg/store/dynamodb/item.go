@@ -0,0 +1,143 @@
+package dynamodb
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// malformedMetrics counts the skipped items by table
+	malformedMetrics = expvar.NewMap("dynamodb_malformed_items")
+
+	errMissingKey = errors.New("missing or non string key attribute")
+	errBadTime    = errors.New("neither an RFC 3339 string nor unix seconds")
+)
+
+// connectionRecord is an item of the users table
+type connectionRecord struct {
+	ConnectionID   string   `dynamodbav:"connection_id"`
+	EventSubdomain string   `dynamodbav:"event_subdomain"`
+	UserID         string   `dynamodbav:"user_id"`
+	IsOrganizer    bool     `dynamodbav:"is_organizer"`
+	ConnectedAt    itemTime `dynamodbav:"connected_at"`
+	Platform       string   `dynamodbav:"platform"`
+	Language       string   `dynamodbav:"language"`
+	Gone           bool     `dynamodbav:"gone"`
+}
+
+// chatServerRecord is an item of the servers table
+type chatServerRecord struct {
+	IP         string            `dynamodbav:"ip"`
+	Port       int               `dynamodbav:"port"`
+	ServerType string            `dynamodbav:"server_type"`
+	Region     string            `dynamodbav:"region"`
+	Capacity   int               `dynamodbav:"capacity"`
+	Labels     map[string]string `dynamodbav:"labels"`
+	Events     []string          `dynamodbav:"events"`
+}
+
+// eventConfigRecord is an item of the chat config table
+type eventConfigRecord struct {
+	EventSubdomain  string   `dynamodbav:"event_subdomain"`
+	DefaultGateway  string   `dynamodbav:"default_gateway"`
+	Audiences       []string `dynamodbav:"audiences"`
+	RateLimit       float64  `dynamodbav:"rate_limit"`
+	RateBurst       int      `dynamodbav:"rate_burst"`
+	MaxMessageBytes int      `dynamodbav:"max_message_bytes"`
+	Muted           bool     `dynamodbav:"muted"`
+	Paused          bool     `dynamodbav:"paused"`
+}
+
+// itemTime reads RFC 3339 strings and unix seconds numbers
+type itemTime struct {
+	time.Time
+}
+
+// UnmarshalDynamoDBAttributeValue implements dynamodbattribute.Unmarshaler
+func (it *itemTime) UnmarshalDynamoDBAttributeValue(attr *dynamodb.AttributeValue) error {
+	switch {
+	case attr.S != nil:
+		t, err := time.Parse(time.RFC3339, *attr.S)
+		if err != nil {
+			return errBadTime
+		}
+		it.Time = t
+	case attr.N != nil:
+		seconds, err := strconv.ParseInt(*attr.N, 10, 64)
+		if err != nil {
+			return errBadTime
+		}
+		it.Time = time.Unix(seconds, 0).UTC()
+	case attr.NULL == nil:
+		return errBadTime
+	}
+	return nil
+}
+
+// unmarshalItem decodes item into record, the items whose key attribute is not a string or
+// that do not fit record are reported through skipMalformed
+func unmarshalItem(table, key string, item map[string]*dynamodb.AttributeValue, record interface{}) bool {
+	err := errMissingKey
+	if attr, exists := item[key]; exists && attr.S != nil && len(*attr.S) > 0 {
+		err = dynamodbattribute.UnmarshalMap(item, record)
+	}
+
+	if err != nil {
+		skipMalformed(table, key, item, err)
+		return false
+	}
+	return true
+}
+
+// skipMalformed logs the key of an item that can not be decoded and counts it
+func skipMalformed(table, key string, item map[string]*dynamodb.AttributeValue, err error) {
+	malformedMetrics.Add(table, 1)
+	log.WithFields(log.Fields{
+		"table": table,
+		"key":   fmt.Sprintf("%s=%s", key, keyValue(item[key])),
+		"error": err,
+	}).Warn("malformed item skipped")
+}
+
+func keyValue(attr *dynamodb.AttributeValue) string {
+	switch {
+	case attr == nil:
+		return "<missing>"
+	case attr.S != nil:
+		return strconv.Quote(*attr.S)
+	case attr.N != nil:
+		return *attr.N
+	}
+	return attr.GoString()
+}
+
+func (cr connectionRecord) connection() store.Connection {
+	return store.Connection{
+		ConnectionID:   cr.ConnectionID,
+		EventSubdomain: cr.EventSubdomain,
+		UserID:         cr.UserID,
+		IsOrganizer:    cr.IsOrganizer,
+		ConnectedAt:    cr.ConnectedAt.Time,
+		Platform:       cr.Platform,
+		Language:       cr.Language,
+		Gone:           cr.Gone,
+	}
+}
+
+func (sr chatServerRecord) chatServer() store.ChatServer {
+	server := store.ChatServer(sr)
+	server.IP = store.AddressIP(sr.IP)
+	return server
+}
+
+func (er eventConfigRecord) eventConfig() store.EventConfig {
+	return store.EventConfig(er)
+}
@@ -0,0 +1,67 @@
+package dynamodb
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func malformedCount(table string) int64 {
+	if count, ok := malformedMetrics.Get(table).(*expvar.Int); ok {
+		return count.Value()
+	}
+	return 0
+}
+
+func TestConnectionsSkipMalformed(t *testing.T) {
+	items := []map[string]*dynamodb.AttributeValue{
+		{connectionIDLabel: {N: aws.String("42")}},
+		{connectionIDLabel: {S: aws.String("conn-organizer")}, isOrganizerLabel: {S: aws.String("true")}},
+		{connectionIDLabel: {S: aws.String("conn-yesterday")}, store.AttrConnectedAt: {S: aws.String("yesterday")}},
+		{store.AttrUserID: {S: aws.String("43")}},
+		{
+			connectionIDLabel:     {S: aws.String("conn-1")},
+			store.AttrUserID:      {N: aws.String("43")},
+			store.AttrConnectedAt: {NULL: aws.Bool(true)},
+		},
+		{connectionIDLabel: {S: aws.String("conn-2")}, store.AttrConnectedAt: {N: aws.String("1601582400")}},
+	}
+
+	db := storage{usersTable: "malformed-users"}
+	malformed := malformedCount("malformed-users")
+	assert.Equal(t, []store.Connection{
+		{ConnectionID: "conn-1", EventSubdomain: "show", UserID: "43"},
+		{ConnectionID: "conn-2", EventSubdomain: "show", ConnectedAt: time.Date(2020, 10, 1, 20, 0, 0, 0, time.UTC)},
+	}, db.connections(items, "show"))
+	assert.Equal(t, int64(4), malformedCount("malformed-users")-malformed)
+}
+
+func TestChatServersSkipMalformed(t *testing.T) {
+	items := []map[string]*dynamodb.AttributeValue{
+		{serversIDLabel: {S: aws.String("10.0.0.1")}, serversPortLabel: {S: aws.String("8080")}},
+		{serversIDLabel: {S: aws.String("10.0.0.2")}, serversPortLabel: {N: aws.String("80.5")}},
+		{serversIDLabel: {S: aws.String("10.0.0.3")}},
+		{serversIDLabel: {N: aws.String("10")}, serversPortLabel: {N: aws.String("8080")}},
+		serverItem("10.0.0.4", "8080"),
+		serverItem("10.0.0.4:8081", "8081"),
+	}
+
+	db := storage{serversTable: "malformed-servers"}
+	malformed := malformedCount("malformed-servers")
+	assert.Equal(t, []store.ChatServer{
+		{IP: "10.0.0.4", Port: 8080, ServerType: "chat"},
+		{IP: "10.0.0.4", Port: 8081, ServerType: "chat"},
+	}, db.appendChatServers(items, nil))
+	assert.Equal(t, int64(4), malformedCount("malformed-servers")-malformed)
+}
+
+func TestKeyValue(t *testing.T) {
+	assert.Equal(t, "<missing>", keyValue(nil))
+	assert.Equal(t, `"conn-1"`, keyValue(&dynamodb.AttributeValue{S: aws.String("conn-1")}))
+	assert.Equal(t, "42", keyValue(&dynamodb.AttributeValue{N: aws.String("42")}))
+}
@@ -0,0 +1,57 @@
+package dynamodb
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+)
+
+// DefaultUsersIndex name suggested for the users table index
+const DefaultUsersIndex = "event_subdomain-index"
+
+// UsersIndexDefinition describes the global secondary index GetUserConnections queries when
+// users-index is configured, it can be applied with
+// `aws dynamodb update-table --cli-input-json`. The index projects the connection attributes
+// queries read, see store.Projection. Provisioned tables also need ProvisionedThroughput on
+// the index.
+func UsersIndexDefinition(usersTable, indexName string, attributes []string) (*dynamodb.UpdateTableInput, error) {
+	projection, err := store.Projection(append([]string{isOrganizerLabel}, attributes...))
+	if err != nil {
+		return nil, err
+	}
+
+	// the index key is always projected, listing it is rejected
+	nonKey := make([]string, 0, len(projection))
+	for _, attribute := range projection {
+		if attribute != eventSubdomainLabel {
+			nonKey = append(nonKey, attribute)
+		}
+	}
+
+	return &dynamodb.UpdateTableInput{
+		TableName: aws.String(usersTable),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(eventSubdomainLabel),
+				AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+			},
+		},
+		GlobalSecondaryIndexUpdates: []*dynamodb.GlobalSecondaryIndexUpdate{
+			{
+				Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+					IndexName: aws.String(indexName),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String(eventSubdomainLabel),
+							KeyType:       aws.String(dynamodb.KeyTypeHash),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType:   aws.String(dynamodb.ProjectionTypeInclude),
+						NonKeyAttributes: aws.StringSlice(nonKey),
+					},
+				},
+			},
+		},
+	}, nil
+}
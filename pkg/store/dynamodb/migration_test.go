@@ -0,0 +1,21 @@
+package dynamodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsersIndexDefinition(t *testing.T) {
+	definition, err := UsersIndexDefinition("users", DefaultUsersIndex, []string{store.AttrEventSubdomain, store.AttrUserID, store.AttrLanguage})
+	if assert.NoError(t, err) {
+		projection := definition.GlobalSecondaryIndexUpdates[0].Create.Projection
+		assert.Equal(t, []string{connectionIDLabel, isOrganizerLabel, store.AttrUserID, store.AttrLanguage}, aws.StringValueSlice(projection.NonKeyAttributes))
+	}
+
+	_, err = UsersIndexDefinition("users", DefaultUsersIndex, []string{"email"})
+	assert.True(t, errors.Is(err, store.ErrUnknownAttribute))
+}
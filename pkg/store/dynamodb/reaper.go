@@ -0,0 +1,140 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxBatchWrite is the BatchWriteItem limit of requests
+	maxBatchWrite     = 25
+	maxBatchRetries   = 5
+	batchRetryBackoff = 50 * time.Millisecond
+)
+
+var (
+	errUnprocessedDeletes = errors.New("connections left unprocessed after retries")
+	staleProjection       = []string{connectionIDLabel, eventSubdomainLabel, isOrganizerLabel, store.AttrConnectedAt, store.AttrGone}
+)
+
+// StreamStaleConnections sends the connections established before connectedBefore or
+// flagged gone while the users table is scanned, pages is not closed. connected_at is
+// compared both as unix seconds and as an RFC 3339 UTC string
+func (db storage) StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []store.Connection) error {
+	filter := expression.Name(store.AttrGone).Equal(expression.Value(true))
+	if !connectedBefore.IsZero() {
+		filter = filter.
+			Or(expression.Name(store.AttrConnectedAt).LessThan(expression.Value(connectedBefore.Unix()))).
+			Or(expression.Name(store.AttrConnectedAt).LessThan(expression.Value(connectedBefore.UTC().Format(time.RFC3339))))
+	}
+
+	projection := expression.NamesList(expression.Name(staleProjection[0]))
+	for _, name := range staleProjection[1:] {
+		projection = projection.AddNames(expression.Name(name))
+	}
+
+	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(projection).Build()
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.ScanInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		TableName:                 aws.String(db.usersTable),
+	}
+
+	err = db.parallelScan(ctx, input, func(items []map[string]*dynamodb.AttributeValue) bool {
+		page := db.connections(items, "")
+		if len(page) == 0 {
+			return true
+		}
+
+		select {
+		case pages <- page:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// DeleteConnections deletes connections from the users table in batches, unprocessed deletes
+// are retried with backoff. It returns how many were deleted
+func (db storage) DeleteConnections(ctx context.Context, connections []store.Connection) (int, error) {
+	deleted := 0
+
+	for start := 0; start < len(connections); start += maxBatchWrite {
+		end := start + maxBatchWrite
+		if end > len(connections) {
+			end = len(connections)
+		}
+
+		requests := make([]*dynamodb.WriteRequest, 0, end-start)
+		for _, conn := range connections[start:end] {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: map[string]*dynamodb.AttributeValue{
+						connectionIDLabel: {S: aws.String(conn.ConnectionID)},
+					},
+				},
+			})
+		}
+
+		unprocessed, err := db.batchDelete(ctx, requests)
+		deleted += len(requests) - unprocessed
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// batchDelete writes requests retrying the unprocessed ones, it returns how many were left
+func (db storage) batchDelete(ctx context.Context, requests []*dynamodb.WriteRequest) (int, error) {
+	backoff := batchRetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		output, err := db.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{db.usersTable: requests},
+		})
+		if err != nil {
+			return len(requests), err
+		}
+
+		requests = output.UnprocessedItems[db.usersTable]
+		if len(requests) == 0 {
+			return 0, nil
+		}
+
+		if attempt == maxBatchRetries {
+			log.WithFields(log.Fields{
+				"table":       db.usersTable,
+				"unprocessed": len(requests),
+			}).Error("unable to delete connections")
+			return len(requests), errUnprocessedDeletes
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return len(requests), ctx.Err()
+		}
+	}
+}
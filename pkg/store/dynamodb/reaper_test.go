@@ -0,0 +1,76 @@
+package dynamodb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchWriteMock leaves the last request of the first call unprocessed
+type batchWriteMock struct {
+	dynamodbiface.DynamoDBAPI
+	calls   int
+	deleted []string
+}
+
+func (bm *batchWriteMock) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	bm.calls++
+	requests := input.RequestItems["users"]
+	output := &dynamodb.BatchWriteItemOutput{}
+
+	if bm.calls == 1 {
+		output.UnprocessedItems = map[string][]*dynamodb.WriteRequest{"users": requests[len(requests)-1:]}
+		requests = requests[:len(requests)-1]
+	}
+
+	for _, req := range requests {
+		bm.deleted = append(bm.deleted, aws.StringValue(req.DeleteRequest.Key[connectionIDLabel].S))
+	}
+	return output, nil
+}
+
+func TestDeleteConnections(t *testing.T) {
+	connections := make([]store.Connection, 0, 60)
+	for i := 0; i < 60; i++ {
+		connections = append(connections, store.Connection{ConnectionID: fmt.Sprintf("conn-%d", i)})
+	}
+
+	mock := &batchWriteMock{}
+	db := storage{DynamoDBAPI: mock, usersTable: "users"}
+
+	deleted, err := db.DeleteConnections(context.Background(), connections)
+	assert.NoError(t, err)
+	assert.Equal(t, 60, deleted)
+	// three batches of up to 25 plus the retry of the unprocessed delete
+	assert.Equal(t, 4, mock.calls)
+	assert.ElementsMatch(t, store.ConnectionIDs(connections), mock.deleted)
+}
+
+func TestStreamStaleConnections(t *testing.T) {
+	mock := &scanMock{pages: [][]map[string]*dynamodb.AttributeValue{{
+		{
+			connectionIDLabel:   {S: aws.String("conn-1")},
+			eventSubdomainLabel: {S: aws.String("show")},
+			store.AttrGone:      {BOOL: aws.Bool(true)},
+		},
+	}}}
+	db := storage{DynamoDBAPI: mock, usersTable: "users"}
+
+	pages := make(chan []store.Connection, 1)
+	assert.NoError(t, db.StreamStaleConnections(context.Background(), time.Now(), pages))
+	assert.Equal(t, []store.Connection{{ConnectionID: "conn-1", EventSubdomain: "show", Gone: true}}, <-pages)
+
+	if assert.Len(t, mock.inputs, 1) {
+		// gone flag plus connected_at as a number and as a string
+		assert.Len(t, mock.inputs[0].ExpressionAttributeValues, 3)
+		assert.Len(t, mock.inputs[0].ExpressionAttributeNames, len(staleProjection))
+	}
+}
@@ -0,0 +1,156 @@
+package dynamodb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	serverCapacityLabel    = "capacity"
+	serverHeartbeatAtLabel = "heartbeat_at"
+	serverExpiresAtLabel   = "expires_at"
+)
+
+// RegisterServer creates or replaces the chat server entry, keyed by its address
+func (db storage) RegisterServer(server store.ServerRegistration) error {
+	item := map[string]*dynamodb.AttributeValue{
+		serversIDLabel:         {S: aws.String(server.Address())},
+		serversPortLabel:       {N: aws.String(strconv.Itoa(server.Port))},
+		serverTypeLabel:        {S: aws.String(server.ServerType)},
+		serverCapacityLabel:    {N: aws.String(strconv.Itoa(server.Capacity))},
+		serverHeartbeatAtLabel: {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		serverExpiresAtLabel:   {N: aws.String(strconv.FormatInt(server.ExpiresAt.Unix(), 10))},
+	}
+
+	if len(server.Events) > 0 {
+		item[serverEventsLabel] = &dynamodb.AttributeValue{SS: aws.StringSlice(server.Events)}
+	}
+	if len(server.Region) > 0 {
+		item[serverRegionLabel] = &dynamodb.AttributeValue{S: aws.String(server.Region)}
+	}
+	if len(server.Labels) > 0 {
+		labels := make(map[string]*dynamodb.AttributeValue, len(server.Labels))
+		for name, value := range server.Labels {
+			labels[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+		}
+		item[serverLabelsLabel] = &dynamodb.AttributeValue{M: labels}
+	}
+
+	_, err := db.PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(db.serversTable),
+	})
+
+	return err
+}
+
+// HeartbeatServer extends the chat server registration until expiresAt
+func (db storage) HeartbeatServer(ip string, port int, expiresAt time.Time) error {
+	update := expression.Set(expression.Name(serverHeartbeatAtLabel), expression.Value(time.Now().Unix())).
+		Set(expression.Name(serverExpiresAtLabel), expression.Value(expiresAt.Unix()))
+	condition := expression.AttributeExists(expression.Name(serversIDLabel))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Key:                       serverKey(store.Address(ip, port)),
+		TableName:                 aws.String(db.serversTable),
+		UpdateExpression:          expr.Update(),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return store.ErrServerNotRegistered
+	}
+
+	return err
+}
+
+// DeregisterServer removes the chat server entry
+func (db storage) DeregisterServer(ip string, port int) error {
+	_, err := db.DeleteItem(&dynamodb.DeleteItemInput{
+		Key:       serverKey(store.Address(ip, port)),
+		TableName: aws.String(db.serversTable),
+	})
+
+	return err
+}
+
+// DeleteExpiredServers removes the self-registered chat servers whose heartbeat expired
+// before now, entries without expiration are left untouched
+func (db storage) DeleteExpiredServers(now time.Time) (int, error) {
+	filter := expression.Name(serverExpiresAtLabel).LessThan(expression.Value(now.Unix()))
+	projection := expression.NamesList(expression.Name(serversIDLabel))
+	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(projection).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	input := &dynamodb.ScanInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		TableName:                 aws.String(db.serversTable),
+	}
+
+	expired := make([]string, 0)
+	err = db.ScanPages(input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range output.Items {
+			if attr, exists := item[serversIDLabel]; exists && attr.S != nil {
+				expired = append(expired, *attr.S)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	condition, err := expression.NewBuilder().WithCondition(filter).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, key := range expired {
+		_, err = db.DeleteItem(&dynamodb.DeleteItemInput{
+			ConditionExpression:       condition.Condition(),
+			ExpressionAttributeNames:  condition.Names(),
+			ExpressionAttributeValues: condition.Values(),
+			Key:                       serverKey(key),
+			TableName:                 aws.String(db.serversTable),
+		})
+
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		log.WithFields(log.Fields{"server": key}).Info("expired chat server removed")
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// serverKey of the servers table, the ip attribute holds the address of self-registered
+// servers and the ip alone of the ones added by hand
+func serverKey(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		serversIDLabel: {S: aws.String(key)},
+	}
+}
@@ -0,0 +1,65 @@
+package dynamodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// itemMock keeps the servers table items by key, updates of missing items fail their condition
+type itemMock struct {
+	dynamodbiface.DynamoDBAPI
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (im *itemMock) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	im.items[aws.StringValue(input.Item[serversIDLabel].S)] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (im *itemMock) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	if _, exists := im.items[aws.StringValue(input.Key[serversIDLabel].S)]; !exists {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (im *itemMock) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	delete(im.items, aws.StringValue(input.Key[serversIDLabel].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestServerRegistration(t *testing.T) {
+	mock := &itemMock{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	db := storage{DynamoDBAPI: mock, serversTable: "servers"}
+	expiresAt := time.Unix(1601582400, 0)
+
+	assert.Equal(t, store.ErrServerNotRegistered, db.HeartbeatServer("10.0.0.1", 8080, expiresAt))
+
+	assert.NoError(t, db.RegisterServer(store.ServerRegistration{
+		IP: "10.0.0.1", Port: 8080, ServerType: "chat", Region: "us-east-1", Capacity: 5000,
+		Labels: map[string]string{"zone": "us-east-1a"}, Events: []string{"el-show-de-producto-online"},
+		ExpiresAt: expiresAt,
+	}))
+
+	item := mock.items["10.0.0.1:8080"]
+	if assert.NotNil(t, item) {
+		assert.Equal(t, "8080", aws.StringValue(item[serversPortLabel].N))
+		assert.Equal(t, "chat", aws.StringValue(item[serverTypeLabel].S))
+		assert.Equal(t, "us-east-1", aws.StringValue(item[serverRegionLabel].S))
+		assert.Equal(t, "5000", aws.StringValue(item[serverCapacityLabel].N))
+		assert.Equal(t, "us-east-1a", aws.StringValue(item[serverLabelsLabel].M["zone"].S))
+		assert.Equal(t, []string{"el-show-de-producto-online"}, aws.StringValueSlice(item[serverEventsLabel].SS))
+		assert.Equal(t, "1601582400", aws.StringValue(item[serverExpiresAtLabel].N))
+	}
+
+	assert.NoError(t, db.HeartbeatServer("10.0.0.1", 8080, expiresAt.Add(time.Minute)))
+	assert.NoError(t, db.DeregisterServer("10.0.0.1", 8080))
+	assert.Empty(t, mock.items)
+}
@@ -0,0 +1,155 @@
+package dynamodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxScanSegments    = 16
+	itemsPerSegment    = 20000
+	segmentsRefreshTTL = time.Hour
+)
+
+type pageFunc func(items []map[string]*dynamodb.AttributeValue) bool
+
+// segmenter chooses the scan segments of every table, a fixed count skips the table size
+type segmenter struct {
+	fixed int
+
+	mu     sync.Mutex
+	counts map[string]tableSegments
+}
+
+type tableSegments struct {
+	segments  int
+	checkedAt time.Time
+}
+
+func newSegmenter(fixed int) *segmenter {
+	return &segmenter{
+		fixed:  fixed,
+		counts: make(map[string]tableSegments),
+	}
+}
+
+// segmentsFor gets the scan segments of table, one segment per itemsPerSegment items as
+// reported by DescribeTable when the count is not fixed
+func (db storage) segmentsFor(ctx context.Context, table string) int {
+	if db.segments == nil {
+		return 1
+	}
+	if db.segments.fixed > 0 {
+		return db.segments.fixed
+	}
+
+	db.segments.mu.Lock()
+	cached, exists := db.segments.counts[table]
+	db.segments.mu.Unlock()
+
+	if exists && time.Since(cached.checkedAt) < segmentsRefreshTTL {
+		return cached.segments
+	}
+
+	segments := 1
+	output, err := db.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"table": table,
+		}).Warn("unable to describe table, scanning serially")
+	} else if output.Table != nil {
+		segments = segmentCount(aws.Int64Value(output.Table.ItemCount))
+	}
+
+	db.segments.mu.Lock()
+	db.segments.counts[table] = tableSegments{segments: segments, checkedAt: time.Now()}
+	db.segments.mu.Unlock()
+
+	return segments
+}
+
+func segmentCount(itemCount int64) int {
+	segments := int((itemCount + itemsPerSegment - 1) / itemsPerSegment)
+	if segments < 1 {
+		return 1
+	}
+	if segments > maxScanSegments {
+		return maxScanSegments
+	}
+	return segments
+}
+
+// parallelScan scans input table split in segments, see runSegments
+func (db storage) parallelScan(ctx context.Context, input *dynamodb.ScanInput, fn pageFunc) error {
+	segments := db.segmentsFor(ctx, aws.StringValue(input.TableName))
+
+	return runSegments(ctx, segments, func(ctx context.Context, segment int, fn pageFunc) error {
+		segmentInput := *input
+		if segments > 1 {
+			segmentInput.Segment = aws.Int64(int64(segment))
+			segmentInput.TotalSegments = aws.Int64(int64(segments))
+		}
+
+		return db.ScanPagesWithContext(ctx, &segmentInput, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+			return fn(output.Items)
+		})
+	}, fn)
+}
+
+// runSegments runs scan concurrently for every segment, calls to fn are serialized so it
+// needs no locking. The first failed segment cancels the rest and fails the whole scan, fn
+// returning false stops every segment without error
+func runSegments(ctx context.Context, segments int, scan func(ctx context.Context, segment int, fn pageFunc) error, fn pageFunc) error {
+	if segments <= 1 {
+		return scan(ctx, 0, fn)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	stopped := false
+
+	serialized := func(items []map[string]*dynamodb.AttributeValue) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped || firstErr != nil {
+			return false
+		}
+		if !fn(items) {
+			stopped = true
+			cancel()
+			return false
+		}
+		return true
+	}
+
+	for segment := 0; segment < segments; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+
+			err := scan(ctx, segment, serialized)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil && !stopped {
+				firstErr = err
+				cancel()
+			}
+		}(segment)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
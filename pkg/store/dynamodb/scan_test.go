@@ -0,0 +1,103 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentCount(t *testing.T) {
+	assert.Equal(t, 1, segmentCount(0))
+	assert.Equal(t, 1, segmentCount(itemsPerSegment))
+	assert.Equal(t, 3, segmentCount(2*itemsPerSegment+1))
+	assert.Equal(t, maxScanSegments, segmentCount(1000*itemsPerSegment))
+}
+
+func TestRunSegments(t *testing.T) {
+	failure := errors.New("provisioned throughput exceeded")
+
+	testCases := []struct {
+		testName      string
+		segments      int
+		failSegment   int
+		expectedErr   error
+		expectedItems int
+	}{
+		{
+			testName:      "SerialCase",
+			segments:      1,
+			failSegment:   -1,
+			expectedItems: 3,
+		},
+		{
+			testName:      "ParallelCase",
+			segments:      4,
+			failSegment:   -1,
+			expectedItems: 12,
+		},
+		{
+			testName:    "FailedSegmentCase",
+			segments:    4,
+			failSegment: 2,
+			expectedErr: failure,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			scan := func(ctx context.Context, segment int, fn pageFunc) error {
+				if segment == c.failSegment {
+					return failure
+				}
+				for page := 0; page < 3; page++ {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					item := map[string]*dynamodb.AttributeValue{
+						connectionIDLabel: {S: aws.String(fmt.Sprintf("conn-%d-%d", segment, page))},
+					}
+					if !fn([]map[string]*dynamodb.AttributeValue{item}) {
+						return nil
+					}
+				}
+				return nil
+			}
+
+			// connections is appended without locking, runSegments serializes fn
+			var connections []store.Connection
+			err := runSegments(context.Background(), c.segments, scan, func(items []map[string]*dynamodb.AttributeValue) bool {
+				connections = append(connections, storage{}.connections(items, "show")...)
+				return true
+			})
+
+			assert.Equal(t, c.expectedErr, err)
+			if c.expectedErr == nil {
+				assert.Len(t, connections, c.expectedItems)
+			}
+		})
+	}
+}
+
+func TestRunSegmentsStops(t *testing.T) {
+	pages := 0
+	err := runSegments(context.Background(), 4, func(ctx context.Context, segment int, fn pageFunc) error {
+		for ctx.Err() == nil {
+			if !fn(nil) {
+				return nil
+			}
+		}
+		return ctx.Err()
+	}, func(items []map[string]*dynamodb.AttributeValue) bool {
+		pages++
+		return pages < 10
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10, pages)
+}
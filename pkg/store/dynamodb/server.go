@@ -1,27 +1,50 @@
 package dynamodb
 
 import (
-	"strconv"
+	"context"
+	"errors"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 )
 
 var (
-	serversIDLabel   = "ip"
-	serversPortLabel = "port"
-	serverTypeLabel  = "server_type"
-	serverType       = "chat"
-)
+	errInvalidPort = errors.New("missing or invalid port")
 
-func (db storage) GetServerConnections(servers map[string]int) error {
+	serversIDLabel       = "ip"
+	serversPortLabel     = "port"
+	serverTypeLabel      = "server_type"
+	serverRegionLabel    = "region"
+	serverLabelsLabel    = "labels"
+	serverEventsLabel    = "events"
+	chatServerProjection = []string{serversIDLabel, serversPortLabel, serverTypeLabel, serverRegionLabel, serverCapacityLabel, serverLabelsLabel, serverEventsLabel}
+)
 
-	projection := expression.NamesList(expression.Name(serversIDLabel), expression.Name(serversPortLabel))
+// GetServerConnections gets every server of serverType, the servers table is scanned in
+// parallel segments
+func (db storage) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
 	filter := expression.Name(serverTypeLabel).Equal(expression.Value(serverType))
+	return db.scanChatServers(ctx, filter)
+}
+
+// GetEventServers gets the servers of serverType registered as hosting subdomain
+func (db storage) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	filter := expression.Name(serverTypeLabel).Equal(expression.Value(serverType)).
+		And(expression.Name(serverEventsLabel).Contains(subdomain))
+	return db.scanChatServers(ctx, filter)
+}
+
+func (db storage) scanChatServers(ctx context.Context, filter expression.ConditionBuilder) ([]store.ChatServer, error) {
+	projection := expression.NamesList(expression.Name(chatServerProjection[0]))
+	for _, name := range chatServerProjection[1:] {
+		projection = projection.AddNames(expression.Name(name))
+	}
+
 	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(projection).Build()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	input := &dynamodb.ScanInput{
@@ -32,45 +55,33 @@ func (db storage) GetServerConnections(servers map[string]int) error {
 		TableName:                 aws.String(db.serversTable),
 	}
 
-	output := &dynamodb.ScanOutput{}
-	for output, err = db.Scan(input); len(output.LastEvaluatedKey) != 0 && err == nil; output, err = db.Scan(input) {
-		if err = appendChatServers(output.Items, servers); err != nil {
-			return err
-		}
+	servers := make([]store.ChatServer, 0)
+	err = db.parallelScan(ctx, input, func(items []map[string]*dynamodb.AttributeValue) bool {
+		servers = db.appendChatServers(items, servers)
+		return true
+	})
 
-		input = &dynamodb.ScanInput{
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
-			FilterExpression:          expr.Filter(),
-			TableName:                 aws.String(db.serversTable),
-		}
-		input.ExclusiveStartKey = output.LastEvaluatedKey
-	}
-
-	if *output.Count > 0 {
-		if err = appendChatServers(output.Items, servers); err != nil {
-			return err
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return servers, nil
 }
 
-func appendChatServers(items []map[string]*dynamodb.AttributeValue, servers map[string]int) error {
+// appendChatServers decodes the servers of items, malformed items and servers without port
+// are skipped
+func (db storage) appendChatServers(items []map[string]*dynamodb.AttributeValue, servers []store.ChatServer) []store.ChatServer {
 	for _, item := range items {
-		if attrIP, exists := item[serversIDLabel]; exists {
-			if attrPort, exists := item[serversPortLabel]; exists {
-				ip := *attrIP.S
-				port, err := strconv.Atoi(*attrPort.N)
-				if err != nil {
-					return err
-				}
-
-				if len(ip) > 0 && port > 0 {
-					servers[ip] = port
-				}
-			}
+		var record chatServerRecord
+		if !unmarshalItem(db.serversTable, serversIDLabel, item, &record) {
+			continue
 		}
+		if record.Port <= 0 {
+			skipMalformed(db.serversTable, serversIDLabel, item, errInvalidPort)
+			continue
+		}
+
+		servers = append(servers, record.chatServer())
 	}
-	return nil
+	return servers
 }
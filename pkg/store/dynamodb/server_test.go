@@ -0,0 +1,140 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// scanMock serves pages of every segment, failing after failAfter pages when set
+type scanMock struct {
+	dynamodbiface.DynamoDBAPI
+	pages     [][]map[string]*dynamodb.AttributeValue
+	failAfter int
+	err       error
+
+	mu     sync.Mutex
+	inputs []dynamodb.ScanInput
+}
+
+func (sm *scanMock) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	sm.mu.Lock()
+	sm.inputs = append(sm.inputs, *input)
+	sm.mu.Unlock()
+
+	pages := sm.pages
+	if input.Segment != nil {
+		pages = sm.pages[aws.Int64Value(input.Segment):][:1]
+	}
+
+	for idx, page := range pages {
+		if sm.err != nil && idx == sm.failAfter {
+			return sm.err
+		}
+		if !fn(&dynamodb.ScanOutput{Items: page}, idx == len(pages)-1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func serverItem(ip, port string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		serversIDLabel:   {S: aws.String(ip)},
+		serversPortLabel: {N: aws.String(port)},
+		serverTypeLabel:  {S: aws.String("chat")},
+	}
+}
+
+func TestGetServerConnections(t *testing.T) {
+	labeled := serverItem("10.0.0.1", "8080")
+	labeled[serverRegionLabel] = &dynamodb.AttributeValue{S: aws.String("us-east-1")}
+	labeled[serverCapacityLabel] = &dynamodb.AttributeValue{N: aws.String("5000")}
+	labeled[serverLabelsLabel] = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+		"zone": {S: aws.String("us-east-1a")},
+	}}
+	labeled[serverEventsLabel] = &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"el-show-de-producto-online"})}
+
+	pages := [][]map[string]*dynamodb.AttributeValue{
+		{labeled, serverItem("10.0.0.1", "8081")},
+		{serverItem("10.0.0.2", "8080"), {serversIDLabel: {S: aws.String("10.0.0.3")}}},
+	}
+	expected := []store.ChatServer{
+		{
+			IP: "10.0.0.1", Port: 8080, ServerType: "chat", Region: "us-east-1", Capacity: 5000,
+			Labels: map[string]string{"zone": "us-east-1a"}, Events: []string{"el-show-de-producto-online"},
+		},
+		{IP: "10.0.0.1", Port: 8081, ServerType: "chat"},
+		{IP: "10.0.0.2", Port: 8080, ServerType: "chat"},
+	}
+	failure := errors.New("provisioned throughput exceeded")
+
+	testCases := []struct {
+		testName        string
+		segments        *segmenter
+		failAfter       int
+		err             error
+		expectedServers []store.ChatServer
+		expectedScans   int
+	}{
+		{
+			testName:        "PagedCase",
+			expectedServers: expected,
+			expectedScans:   1,
+		},
+		{
+			testName:        "SegmentedCase",
+			segments:        newSegmenter(2),
+			expectedServers: expected,
+			expectedScans:   2,
+		},
+		{
+			testName:      "FailedPageCase",
+			failAfter:     1,
+			err:           failure,
+			expectedScans: 1,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			mock := &scanMock{pages: pages, failAfter: c.failAfter, err: c.err}
+			db := storage{DynamoDBAPI: mock, serversTable: "servers", segments: c.segments}
+
+			servers, err := db.GetServerConnections(context.Background(), "chat")
+			assert.Equal(t, c.err, err)
+			assert.ElementsMatch(t, c.expectedServers, servers)
+
+			if assert.Len(t, mock.inputs, c.expectedScans) {
+				for _, input := range mock.inputs {
+					assert.Equal(t, "servers", aws.StringValue(input.TableName))
+					assert.NotEmpty(t, aws.StringValue(input.ProjectionExpression))
+					assert.Len(t, input.ExpressionAttributeNames, len(chatServerProjection))
+				}
+			}
+		})
+	}
+}
+
+func TestGetEventServersFiltersByEvent(t *testing.T) {
+	mock := &scanMock{pages: [][]map[string]*dynamodb.AttributeValue{{serverItem("10.0.0.1", "8080")}}}
+	db := storage{DynamoDBAPI: mock, serversTable: "servers"}
+
+	servers, err := db.GetEventServers(context.Background(), "chat", "el-show-de-producto-online")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []store.ChatServer{{IP: "10.0.0.1", Port: 8080, ServerType: "chat"}}, servers)
+	}
+
+	if assert.Len(t, mock.inputs, 1) {
+		assert.Contains(t, aws.StringValue(mock.inputs[0].FilterExpression), "contains")
+		assert.Contains(t, mock.inputs[0].ExpressionAttributeValues, ":1")
+	}
+}
@@ -1,20 +1,58 @@
 package dynamodb
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
 )
 
 const (
-	connectionIDLabel   = "connection_id"
-	eventSubdomainLabel = "event_subdomain"
-	isOrganizerLabel    = "is_organizer"
+	connectionIDLabel   = store.AttrConnectionID
+	eventSubdomainLabel = store.AttrEventSubdomain
+	isOrganizerLabel    = store.AttrIsOrganizer
 	audienceOrganizer   = "organizer"
 	audienceAttendance  = "attendance"
 )
 
-func (db storage) GetUserConnections(subdomain string, audienceType string, connections *[]string) error {
+// GetUserConnections gets the connections of subdomain audience, it queries the users index
+// when one is configured and scans the whole table in parallel segments otherwise
+func (db storage) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error {
+	return db.userConnectionPages(ctx, subdomain, audienceType, func(page []store.Connection) bool {
+		*connections = append(*connections, page...)
+		return true
+	})
+}
+
+// StreamUserConnections sends the connections of subdomain audience to pages as every
+// scan or query page arrives, pages is not closed
+func (db storage) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error {
+	err := db.userConnectionPages(ctx, subdomain, audienceType, func(page []store.Connection) bool {
+		if len(page) == 0 {
+			return true
+		}
+
+		select {
+		case pages <- page:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (db storage) userConnectionPages(ctx context.Context, subdomain string, audienceType string, fn func(page []store.Connection) bool) error {
+	if len(db.usersIndex) > 0 {
+		return db.queryUserConnections(ctx, subdomain, audienceType, fn)
+	}
+
 	var isOrganizer bool
 
 	switch audienceType {
@@ -34,8 +72,7 @@ func (db storage) GetUserConnections(subdomain string, audienceType string, conn
 		filter = expression.Name(eventSubdomainLabel).Equal(expression.Value(subdomain))
 	}
 
-	projection := expression.NamesList(expression.Name(connectionIDLabel))
-	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(projection).Build()
+	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(db.connectionProjection()).Build()
 	if err != nil {
 		return err
 	}
@@ -48,28 +85,64 @@ func (db storage) GetUserConnections(subdomain string, audienceType string, conn
 		TableName:                 aws.String(db.usersTable),
 	}
 
-	db.ScanPages(input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
-		if err = appendResults(output.Items, connections); err != nil {
-			return false
-		}
-		return true
+	return db.parallelScan(ctx, input, func(items []map[string]*dynamodb.AttributeValue) bool {
+		return fn(db.connections(items, subdomain))
 	})
+}
+
+func (db storage) queryUserConnections(ctx context.Context, subdomain string, audienceType string, fn func(page []store.Connection) bool) error {
+	keyCondition := expression.Key(eventSubdomainLabel).Equal(expression.Value(subdomain))
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition).WithProjection(db.connectionProjection())
+
+	switch audienceType {
+	case audienceOrganizer:
+		builder = builder.WithFilter(expression.Name(isOrganizerLabel).Equal(expression.Value(true)))
+	case audienceAttendance:
+		builder = builder.WithFilter(expression.Name(isOrganizerLabel).Equal(expression.Value(false)))
+	}
 
+	expr, err := builder.Build()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		IndexName:                 aws.String(db.usersIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+		TableName:                 aws.String(db.usersTable),
+	}
+
+	return db.QueryPagesWithContext(ctx, input, func(output *dynamodb.QueryOutput, lastPage bool) bool {
+		return fn(db.connections(output.Items, subdomain))
+	})
+}
+
+// connectionProjection projects the configured connection attributes, only the connection
+// id when none is configured
+func (db storage) connectionProjection() expression.ProjectionBuilder {
+	projection := expression.NamesList(expression.Name(connectionIDLabel))
+	for _, attribute := range db.connectionAttributes {
+		if attribute != connectionIDLabel {
+			projection = projection.AddNames(expression.Name(attribute))
+		}
+	}
+	return projection
 }
 
-func appendResults(items []map[string]*dynamodb.AttributeValue, connections *[]string) error {
+// connections decodes the connections of items, malformed items are skipped and subdomain
+// is used when the event subdomain is not projected
+func (db storage) connections(items []map[string]*dynamodb.AttributeValue, subdomain string) []store.Connection {
+	connections := make([]store.Connection, 0, len(items))
 	for _, item := range items {
-		if attr, exists := item[connectionIDLabel]; exists {
-			id := *attr.S
-			if len(id) > 0 {
-				*connections = append(*connections, id)
-			}
+		record := connectionRecord{EventSubdomain: subdomain}
+		if !unmarshalItem(db.usersTable, connectionIDLabel, item, &record) {
+			continue
 		}
+		connections = append(connections, record.connection())
 	}
-	return nil
+	return connections
 }
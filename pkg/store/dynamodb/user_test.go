@@ -1,18 +1,84 @@
 package dynamodb
 
-/*
-func TestGetUserConnections(t *testing.T) {
-	//func (db storage) GetUserConnections(subdomain string, audienceType string, connections *[]string) error {
+import (
+	"context"
+	"testing"
+	"time"
 
-	dyMock := &mockDynamoDBClient{}
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
 
-	store := storage{
-		dyMock,
-	}
+type queryMock struct {
+	dynamodbiface.DynamoDBAPI
+	items  []map[string]*dynamodb.AttributeValue
+	inputs []dynamodb.QueryInput
+}
 
+func (qm *queryMock) QueryPagesWithContext(ctx aws.Context, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	qm.inputs = append(qm.inputs, *input)
+	fn(&dynamodb.QueryOutput{Items: qm.items}, true)
+	return nil
 }
 
-type mockDynamoDBClient struct {
-	dynamodbiface.DynamoDBAPI
+func TestGetUserConnections(t *testing.T) {
+	connectedAt := time.Date(2020, 10, 1, 20, 0, 0, 0, time.UTC)
+	items := []map[string]*dynamodb.AttributeValue{
+		{
+			connectionIDLabel:     {S: aws.String("conn-1")},
+			store.AttrUserID:      {N: aws.String("42")},
+			isOrganizerLabel:      {BOOL: aws.Bool(true)},
+			store.AttrConnectedAt: {N: aws.String("1601582400")},
+			store.AttrPlatform:    {S: aws.String("ios")},
+			store.AttrLanguage:    {S: aws.String("es")},
+		},
+		{
+			connectionIDLabel:     {S: aws.String("conn-2")},
+			store.AttrConnectedAt: {S: aws.String("2020-10-01T20:00:00Z")},
+		},
+		{store.AttrUserID: {S: aws.String("43")}},
+	}
+	expected := []store.Connection{
+		{
+			ConnectionID: "conn-1", EventSubdomain: "show", UserID: "42", IsOrganizer: true,
+			ConnectedAt: connectedAt, Platform: "ios", Language: "es",
+		},
+		{ConnectionID: "conn-2", EventSubdomain: "show", ConnectedAt: connectedAt},
+	}
+
+	attributes, err := store.Projection([]string{store.AttrLanguage, store.AttrUserID})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("ScanCase", func(t *testing.T) {
+		mock := &scanMock{pages: [][]map[string]*dynamodb.AttributeValue{items}}
+		db := storage{DynamoDBAPI: mock, usersTable: "users", connectionAttributes: attributes}
+
+		var connections []store.Connection
+		if assert.NoError(t, db.GetUserConnections(context.Background(), "show", "", &connections)) {
+			assert.Equal(t, expected, connections)
+		}
+		if assert.Len(t, mock.inputs, 1) {
+			assert.Len(t, mock.inputs[0].ExpressionAttributeNames, 4)
+		}
+	})
+
+	t.Run("QueryCase", func(t *testing.T) {
+		mock := &queryMock{items: items}
+		db := storage{DynamoDBAPI: mock, usersTable: "users", usersIndex: "event_subdomain-index"}
+
+		var connections []store.Connection
+		if assert.NoError(t, db.GetUserConnections(context.Background(), "show", "organizer", &connections)) {
+			assert.Equal(t, expected, connections)
+		}
+		if assert.Len(t, mock.inputs, 1) {
+			// event_subdomain and is_organizer for the conditions, connection_id projected
+			assert.Len(t, mock.inputs[0].ExpressionAttributeNames, 3)
+		}
+	})
 }
-*/
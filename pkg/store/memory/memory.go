@@ -0,0 +1,383 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	audienceOrganizer  = "organizer"
+	audienceAttendance = "attendance"
+)
+
+type fixture struct {
+	Connections  []fixtureConnection  `mapstructure:"connections"`
+	Servers      []fixtureServer      `mapstructure:"servers"`
+	EventConfigs []fixtureEventConfig `mapstructure:"event_configs"`
+}
+
+type fixtureConnection struct {
+	ConnectionID   string `mapstructure:"connection_id"`
+	EventSubdomain string `mapstructure:"event_subdomain"`
+	UserID         string `mapstructure:"user_id"`
+	IsOrganizer    bool   `mapstructure:"is_organizer"`
+	// ConnectedAt in RFC 3339
+	ConnectedAt string `mapstructure:"connected_at"`
+	Platform    string `mapstructure:"platform"`
+	Language    string `mapstructure:"language"`
+	Gone        bool   `mapstructure:"gone"`
+}
+
+type fixtureServer struct {
+	IP         string            `mapstructure:"ip"`
+	Port       int               `mapstructure:"port"`
+	ServerType string            `mapstructure:"server_type"`
+	Region     string            `mapstructure:"region"`
+	Capacity   int               `mapstructure:"capacity"`
+	Labels     map[string]string `mapstructure:"labels"`
+	Events     []string          `mapstructure:"events"`
+}
+
+type fixtureEventConfig struct {
+	EventSubdomain  string   `mapstructure:"event_subdomain"`
+	DefaultGateway  string   `mapstructure:"default_gateway"`
+	Audiences       []string `mapstructure:"audiences"`
+	RateLimit       float64  `mapstructure:"rate_limit"`
+	RateBurst       int      `mapstructure:"rate_burst"`
+	MaxMessageBytes int      `mapstructure:"max_message_bytes"`
+	Muted           bool     `mapstructure:"muted"`
+	Paused          bool     `mapstructure:"paused"`
+}
+
+type storage struct {
+	mu sync.RWMutex
+	// connections indexed by subdomain and connection id, records are kept whole so every
+	// attribute is returned regardless of projection
+	connections map[string]map[string]store.Connection
+	// servers indexed by address
+	servers map[string]store.ServerRegistration
+	configs map[string]store.EventConfig
+}
+
+// New creates an empty in-memory store
+func New() *storage {
+	return &storage{
+		connections: make(map[string]map[string]store.Connection),
+		servers:     make(map[string]store.ServerRegistration),
+		configs:     make(map[string]store.EventConfig),
+	}
+}
+
+// Load creates an in-memory store seeded from a json or yaml fixture, the format is taken
+// from the file extension
+func Load(path string) (*storage, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"fixture": path,
+		}).Error("unable to read store fixture")
+		return nil, err
+	}
+
+	seed := fixture{}
+	if err := v.Unmarshal(&seed); err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"fixture": path,
+		}).Error("unable to decode store fixture")
+		return nil, err
+	}
+
+	db := New()
+	for _, conn := range seed.Connections {
+		connection := store.Connection{
+			ConnectionID:   conn.ConnectionID,
+			EventSubdomain: conn.EventSubdomain,
+			UserID:         conn.UserID,
+			IsOrganizer:    conn.IsOrganizer,
+			Platform:       conn.Platform,
+			Language:       conn.Language,
+			Gone:           conn.Gone,
+		}
+
+		if len(conn.ConnectedAt) > 0 {
+			connectedAt, err := time.Parse(time.RFC3339, conn.ConnectedAt)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":         err,
+					"fixture":       path,
+					"connection_id": conn.ConnectionID,
+				}).Error("unable to decode connected_at")
+				return nil, err
+			}
+			connection.ConnectedAt = connectedAt
+		}
+
+		db.AddConnection(context.Background(), connection)
+	}
+	for _, server := range seed.Servers {
+		db.RegisterServer(store.ServerRegistration{
+			IP:         server.IP,
+			Port:       server.Port,
+			ServerType: server.ServerType,
+			Region:     server.Region,
+			Capacity:   server.Capacity,
+			Labels:     server.Labels,
+			Events:     server.Events,
+		})
+	}
+
+	for _, config := range seed.EventConfigs {
+		db.SetEventConfig(context.Background(), store.EventConfig(config))
+	}
+
+	log.WithFields(log.Fields{
+		"fixture":       path,
+		"connections":   len(seed.Connections),
+		"servers":       len(seed.Servers),
+		"event_configs": len(seed.EventConfigs),
+	}).Info("in-memory store seeded")
+
+	return db, nil
+}
+
+// GetUserConnections gets the connections of subdomain audience, every connection of the
+// event is returned for an unknown audience
+func (db *storage) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, conn := range db.connections[subdomain] {
+		switch {
+		case audienceType == audienceOrganizer && !conn.IsOrganizer:
+			continue
+		case audienceType == audienceAttendance && conn.IsOrganizer:
+			continue
+		}
+		*connections = append(*connections, conn)
+	}
+
+	return nil
+}
+
+// StreamUserConnections sends the connections of subdomain audience to pages as a single
+// page, pages is not closed
+func (db *storage) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error {
+	var page []store.Connection
+	db.GetUserConnections(ctx, subdomain, audienceType, &page)
+
+	if len(page) == 0 {
+		return nil
+	}
+
+	select {
+	case pages <- page:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AddConnection adds conn to its event
+func (db *storage) AddConnection(ctx context.Context, conn store.Connection) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	event, exists := db.connections[conn.EventSubdomain]
+	if !exists {
+		event = make(map[string]store.Connection)
+		db.connections[conn.EventSubdomain] = event
+	}
+	event[conn.ConnectionID] = conn
+
+	return nil
+}
+
+// RemoveConnection removes conn from its event
+func (db *storage) RemoveConnection(ctx context.Context, conn store.Connection) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.connections[conn.EventSubdomain], conn.ConnectionID)
+	if len(db.connections[conn.EventSubdomain]) == 0 {
+		delete(db.connections, conn.EventSubdomain)
+	}
+
+	return nil
+}
+
+// StreamStaleConnections sends the connections established before connectedBefore or
+// flagged gone as a single page, pages is not closed
+func (db *storage) StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []store.Connection) error {
+	db.mu.RLock()
+	var page []store.Connection
+	for _, event := range db.connections {
+		for _, conn := range event {
+			expired := !conn.ConnectedAt.IsZero() && conn.ConnectedAt.Before(connectedBefore)
+			if conn.Gone || expired {
+				page = append(page, conn)
+			}
+		}
+	}
+	db.mu.RUnlock()
+
+	if len(page) == 0 {
+		return nil
+	}
+
+	select {
+	case pages <- page:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeleteConnections removes connections, it returns how many were deleted
+func (db *storage) DeleteConnections(ctx context.Context, connections []store.Connection) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	deleted := 0
+	for _, conn := range connections {
+		if _, exists := db.connections[conn.EventSubdomain][conn.ConnectionID]; !exists {
+			continue
+		}
+
+		delete(db.connections[conn.EventSubdomain], conn.ConnectionID)
+		if len(db.connections[conn.EventSubdomain]) == 0 {
+			delete(db.connections, conn.EventSubdomain)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// GetServerConnections gets every server of serverType
+func (db *storage) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	return db.chatServers(serverType, ""), nil
+}
+
+// GetEventServers gets the servers of serverType registered as hosting subdomain
+func (db *storage) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	return db.chatServers(serverType, subdomain), nil
+}
+
+// chatServers gets the servers of serverType, only those hosting subdomain unless it is empty
+func (db *storage) chatServers(serverType string, subdomain string) []store.ChatServer {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	servers := make([]store.ChatServer, 0)
+	for _, server := range db.servers {
+		if server.ServerType != serverType || !hosts(server, subdomain) {
+			continue
+		}
+
+		servers = append(servers, store.ChatServer{
+			IP:         server.IP,
+			Port:       server.Port,
+			ServerType: server.ServerType,
+			Region:     server.Region,
+			Capacity:   server.Capacity,
+			Labels:     server.Labels,
+			Events:     server.Events,
+		})
+	}
+
+	return servers
+}
+
+func hosts(server store.ServerRegistration, subdomain string) bool {
+	if len(subdomain) == 0 {
+		return true
+	}
+	for _, event := range server.Events {
+		if event == subdomain {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterServer creates or replaces the chat server entry
+func (db *storage) RegisterServer(server store.ServerRegistration) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.servers[server.Address()] = server
+	return nil
+}
+
+// HeartbeatServer extends the chat server registration until expiresAt
+func (db *storage) HeartbeatServer(ip string, port int, expiresAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	address := store.Address(ip, port)
+	server, exists := db.servers[address]
+	if !exists {
+		return store.ErrServerNotRegistered
+	}
+
+	server.ExpiresAt = expiresAt
+	db.servers[address] = server
+	return nil
+}
+
+// DeregisterServer removes the chat server entry
+func (db *storage) DeregisterServer(ip string, port int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.servers, store.Address(ip, port))
+	return nil
+}
+
+// DeleteExpiredServers removes the self-registered chat servers whose heartbeat expired
+// before now, entries without expiration are left untouched
+func (db *storage) DeleteExpiredServers(now time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	deleted := 0
+	for address, server := range db.servers {
+		if !server.ExpiresAt.IsZero() && server.ExpiresAt.Before(now) {
+			delete(db.servers, address)
+			log.WithFields(log.Fields{"server": address}).Info("expired chat server removed")
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// GetEventConfigs gets the dispatch settings of every event
+func (db *storage) GetEventConfigs(ctx context.Context, configs map[string]store.EventConfig) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for subdomain, config := range db.configs {
+		configs[subdomain] = config
+	}
+
+	return nil
+}
+
+// SetEventConfig creates or replaces the dispatch settings of config event
+func (db *storage) SetEventConfig(ctx context.Context, config store.EventConfig) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.configs[config.EventSubdomain] = config
+	return nil
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, seed storetest.Seed) store.Store {
+		db := New()
+		for _, conn := range seed.Connections {
+			db.AddConnection(context.Background(), conn)
+		}
+		for _, config := range seed.EventConfigs {
+			db.SetEventConfig(context.Background(), config)
+		}
+		return db
+	})
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		testName string
+		fixture  string
+		err      bool
+	}{
+		{
+			testName: "YAMLCase",
+			fixture:  "testdata/fixture.yaml",
+		},
+		{
+			testName: "JSONCase",
+			fixture:  "testdata/fixture.json",
+		},
+		{
+			testName: "MissingFixtureCase",
+			fixture:  "testdata/missing.yaml",
+			err:      true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			db, err := Load(c.fixture)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var connections []store.Connection
+			assert.NoError(t, db.GetUserConnections(context.Background(), "el-show-de-producto-online", "organizer", &connections))
+			assert.Equal(t, []store.Connection{{
+				ConnectionID: "conn-organizer-1", EventSubdomain: "el-show-de-producto-online", UserID: "42", IsOrganizer: true,
+				ConnectedAt: time.Date(2020, 10, 1, 20, 0, 0, 0, time.UTC), Platform: "web", Language: "es",
+			}}, connections)
+
+			servers, err := db.GetEventServers(context.Background(), "chat", "el-show-de-producto-online")
+			assert.NoError(t, err)
+			assert.Equal(t, []store.ChatServer{{
+				IP: "127.0.0.1", Port: 8080, ServerType: "chat", Region: "local", Labels: map[string]string{"zone": "a"},
+				Events: []string{"el-show-de-producto-online"},
+			}}, servers)
+
+			configs := map[string]store.EventConfig{}
+			assert.NoError(t, db.GetEventConfigs(context.Background(), configs))
+			assert.Equal(t, map[string]store.EventConfig{"el-show-de-producto-online": {
+				EventSubdomain: "el-show-de-producto-online",
+				DefaultGateway: "chat-server-v2",
+				Audiences:      []string{"attendance"},
+				RateLimit:      10,
+				Paused:         true,
+			}}, configs)
+		})
+	}
+}
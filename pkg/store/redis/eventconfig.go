@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetEventConfigs gets the dispatch settings of every event, malformed settings are skipped
+func (db storage) GetEventConfigs(ctx context.Context, configs map[string]store.EventConfig) error {
+	values, err := db.client.WithContext(ctx).HGetAll(db.eventConfigsKey()).Result()
+	if err != nil {
+		return err
+	}
+
+	for subdomain, value := range values {
+		config := store.EventConfig{}
+		if err := json.Unmarshal([]byte(value), &config); err != nil {
+			log.WithFields(log.Fields{
+				"error":           err,
+				"event_subdomain": subdomain,
+			}).Warn("skipping malformed event config")
+			continue
+		}
+
+		config.EventSubdomain = subdomain
+		configs[subdomain] = config
+	}
+
+	return nil
+}
+
+// SetEventConfig creates or replaces the dispatch settings of config event
+func (db storage) SetEventConfig(ctx context.Context, config store.EventConfig) error {
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return db.client.WithContext(ctx).HSet(db.eventConfigsKey(), config.EventSubdomain, value).Err()
+}
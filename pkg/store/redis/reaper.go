@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+var staleFields = []string{store.AttrEventSubdomain, store.AttrIsOrganizer, store.AttrConnectedAt, store.AttrGone}
+
+// StreamStaleConnections sends the connections established before connectedBefore or
+// flagged gone while the connection hashes are scanned, pages is not closed. Connections
+// added without attributes are never stale
+func (db storage) StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []store.Connection) error {
+	client := db.client.WithContext(ctx)
+	match := db.connectionKey("*")
+	var cursor uint64
+
+	for {
+		keys, next, err := client.Scan(cursor, match, streamPageSize).Result()
+		if err != nil {
+			return err
+		}
+
+		page, err := db.staleConnections(ctx, keys, connectedBefore)
+		if err != nil {
+			return err
+		}
+
+		if len(page) > 0 {
+			select {
+			case pages <- page:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (db storage) staleConnections(ctx context.Context, keys []string, connectedBefore time.Time) ([]store.Connection, error) {
+	stale := make([]store.Connection, 0)
+	if len(keys) == 0 {
+		return stale, nil
+	}
+
+	pipe := db.client.WithContext(ctx).Pipeline()
+
+	cmds := make([]*goredis.SliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HMGet(key, staleFields...)
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	prefix := db.connectionKey("")
+	for i, cmd := range cmds {
+		conn := store.Connection{ConnectionID: strings.TrimPrefix(keys[i], prefix)}
+		for idx, value := range cmd.Val() {
+			if value, isString := value.(string); isString {
+				setAttribute(&conn, staleFields[idx], value)
+			}
+		}
+
+		expired := !conn.ConnectedAt.IsZero() && conn.ConnectedAt.Before(connectedBefore)
+		if conn.Gone || expired {
+			stale = append(stale, conn)
+		}
+	}
+
+	return stale, nil
+}
+
+// DeleteConnections removes connections from their sets along with their attributes, it
+// returns how many were deleted
+func (db storage) DeleteConnections(ctx context.Context, connections []store.Connection) (int, error) {
+	if len(connections) == 0 {
+		return 0, nil
+	}
+
+	cmds := make([]*goredis.IntCmd, len(connections))
+	_, err := db.client.WithContext(ctx).TxPipelined(func(pipe goredis.Pipeliner) error {
+		for i, conn := range connections {
+			pipe.SRem(db.eventKey(conn.EventSubdomain), conn.ConnectionID)
+			pipe.SRem(db.audienceKey(conn.EventSubdomain, audienceOf(conn)), conn.ConnectionID)
+			cmds[i] = pipe.Del(db.connectionKey(conn.ConnectionID))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, cmd := range cmds {
+		deleted += int(cmd.Val())
+	}
+	return deleted, nil
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"errors"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	goredis "github.com/go-redis/redis/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultKeyPrefix = "ws-dispatcher:"
+
+var errHeartbeatRace = errors.New("chat server heartbeat arrived while expiring it")
+
+// Settings redis connection settings, KeyPrefix namespaces every key of the store
+type Settings struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string
+	// ConnectionAttributes read besides the connection id, see store.Projection
+	ConnectionAttributes []string
+}
+
+type storage struct {
+	client     *goredis.Client
+	prefix     string
+	attributes []string
+}
+
+// New creates new redis client, it fails when redis is not reachable
+func New(settings Settings) (storage, error) {
+	if len(settings.KeyPrefix) == 0 {
+		settings.KeyPrefix = defaultKeyPrefix
+	}
+
+	attributes, err := store.Projection(settings.ConnectionAttributes)
+	if err != nil {
+		return storage{}, err
+	}
+
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     settings.Addr,
+		Password: settings.Password,
+		DB:       settings.DB,
+	})
+
+	if err := client.Ping().Err(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"addr":  settings.Addr,
+		}).Error("unable to connect to redis")
+		return storage{}, err
+	}
+
+	return storage{
+		client:     client,
+		prefix:     settings.KeyPrefix,
+		attributes: attributes,
+	}, nil
+}
+
+// Close closes the redis connections
+func (db storage) Close() error {
+	return db.client.Close()
+}
+
+// eventKey set of every connection of subdomain, audience keys hold its subsets
+func (db storage) eventKey(subdomain string) string {
+	return db.prefix + "event:" + subdomain
+}
+
+func (db storage) audienceKey(subdomain string, audienceType string) string {
+	return db.eventKey(subdomain) + ":" + audienceType
+}
+
+// connectionKey hash of the attributes of a connection
+func (db storage) connectionKey(id string) string {
+	return db.prefix + "connection:" + id
+}
+
+// serverKey hash of a chat server, keyed by its address
+func (db storage) serverKey(address string) string {
+	return db.prefix + "server:" + address
+}
+
+// serversKey sorted set of chat servers scored by registration expiration, 0 never expires
+func (db storage) serversKey() string {
+	return db.prefix + "servers"
+}
+
+// eventServersKey set of chat servers hosting subdomain
+func (db storage) eventServersKey(subdomain string) string {
+	return db.prefix + "event-servers:" + subdomain
+}
+
+// eventConfigsKey hash of event dispatch settings encoded as json, indexed by subdomain
+func (db storage) eventConfigsKey() string {
+	return db.prefix + "event-configs"
+}
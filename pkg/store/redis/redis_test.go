@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/boletia/ws-message-dispatcher/pkg/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStore runs the store suite against REDIS_ADDR when set and an in-process redis otherwise
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, seed storetest.Seed) store.Store {
+		settings := Settings{
+			Addr:                 os.Getenv("REDIS_ADDR"),
+			KeyPrefix:            "ws-dispatcher-test:" + t.Name() + ":",
+			ConnectionAttributes: store.ConnectionAttributes,
+		}
+
+		if len(settings.Addr) == 0 {
+			server, err := miniredis.Run()
+			if err != nil {
+				t.Fatalf("unable to start redis: %s", err)
+			}
+			t.Cleanup(server.Close)
+			settings.Addr = server.Addr()
+		}
+
+		db, err := New(settings)
+		if err != nil {
+			t.Fatalf("unable to connect to redis: %s", err)
+		}
+		t.Cleanup(func() { cleanup(t, db) })
+
+		for _, conn := range seed.Connections {
+			if err := db.AddConnection(context.Background(), conn); err != nil {
+				t.Fatalf("unable to seed connections: %s", err)
+			}
+		}
+
+		for _, config := range seed.EventConfigs {
+			if err := db.SetEventConfig(context.Background(), config); err != nil {
+				t.Fatalf("unable to seed event configs: %s", err)
+			}
+		}
+
+		return db
+	})
+}
+
+func cleanup(t *testing.T, db storage) {
+	keys, err := db.client.Keys(db.prefix + "*").Result()
+	if err == nil && len(keys) > 0 {
+		err = db.client.Del(keys...).Err()
+	}
+	if err != nil {
+		t.Errorf("unable to clean up redis: %s", err)
+	}
+	db.Close()
+}
+
+func TestConnectionProjection(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("unable to start redis: %s", err)
+	}
+	defer server.Close()
+
+	_, err = New(Settings{Addr: server.Addr(), ConnectionAttributes: []string{"country"}})
+	assert.True(t, errors.Is(err, store.ErrUnknownAttribute))
+
+	db, err := New(Settings{Addr: server.Addr(), ConnectionAttributes: []string{store.AttrLanguage}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	assert.NoError(t, db.AddConnection(context.Background(), storetest.Connections[0]))
+
+	var connections []store.Connection
+	if assert.NoError(t, db.GetUserConnections(context.Background(), "el-show-de-producto-online", "", &connections)) {
+		assert.Equal(t, []store.Connection{{
+			ConnectionID:   "conn-organizer-1",
+			EventSubdomain: "el-show-de-producto-online",
+			Language:       "es",
+		}}, connections)
+	}
+}
+
+func TestUnseen(t *testing.T) {
+	seen := make(map[string]bool)
+
+	assert.Equal(t, []string{"conn-1", "conn-2"}, unseen([]string{"conn-1", "conn-2"}, seen))
+	assert.Equal(t, []string{"conn-3"}, unseen([]string{"conn-2", "conn-3", "conn-1"}, seen))
+	assert.Empty(t, unseen([]string{"conn-3"}, seen))
+}
@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	goredis "github.com/go-redis/redis/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+// RegisterServer creates or replaces the chat server entry
+func (db storage) RegisterServer(server store.ServerRegistration) error {
+	address := server.Address()
+	key := db.serverKey(address)
+
+	previous, err := db.client.HGet(key, serverEventsLabel).Result()
+	if err != nil && err != goredis.Nil {
+		return err
+	}
+
+	labels := []byte{}
+	if len(server.Labels) > 0 {
+		if labels, err = json.Marshal(server.Labels); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.client.TxPipelined(func(pipe goredis.Pipeliner) error {
+		for _, subdomain := range splitEvents(previous) {
+			pipe.SRem(db.eventServersKey(subdomain), address)
+		}
+
+		pipe.Del(key)
+		pipe.HSet(key,
+			serversPortLabel, server.Port,
+			serverTypeLabel, server.ServerType,
+			serverRegionLabel, server.Region,
+			serverCapacityLabel, server.Capacity,
+			serverLabelsLabel, string(labels),
+			serverEventsLabel, strings.Join(server.Events, eventsSeparator),
+			serverHeartbeatAtLabel, time.Now().Unix(),
+			serverExpiresAtLabel, expiresAtScore(server.ExpiresAt),
+		)
+		pipe.ZAdd(db.serversKey(), &goredis.Z{Score: float64(expiresAtScore(server.ExpiresAt)), Member: address})
+
+		for _, subdomain := range server.Events {
+			pipe.SAdd(db.eventServersKey(subdomain), address)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// HeartbeatServer extends the chat server registration until expiresAt
+func (db storage) HeartbeatServer(ip string, port int, expiresAt time.Time) error {
+	address := store.Address(ip, port)
+	key := db.serverKey(address)
+
+	err := db.client.Watch(func(tx *goredis.Tx) error {
+		exists, err := tx.Exists(key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return store.ErrServerNotRegistered
+		}
+
+		_, err = tx.TxPipelined(func(pipe goredis.Pipeliner) error {
+			pipe.HSet(key,
+				serverHeartbeatAtLabel, time.Now().Unix(),
+				serverExpiresAtLabel, expiresAt.Unix(),
+			)
+			pipe.ZAdd(db.serversKey(), &goredis.Z{Score: float64(expiresAt.Unix()), Member: address})
+			return nil
+		})
+		return err
+	}, key)
+
+	return err
+}
+
+// DeregisterServer removes the chat server entry
+func (db storage) DeregisterServer(ip string, port int) error {
+	address := store.Address(ip, port)
+	key := db.serverKey(address)
+
+	events, err := db.client.HGet(key, serverEventsLabel).Result()
+	if err != nil && err != goredis.Nil {
+		return err
+	}
+
+	_, err = db.client.TxPipelined(func(pipe goredis.Pipeliner) error {
+		db.deleteServer(pipe, address, events)
+		return nil
+	})
+
+	return err
+}
+
+// DeleteExpiredServers removes the self-registered chat servers whose heartbeat expired
+// before now, entries without expiration are left untouched
+func (db storage) DeleteExpiredServers(now time.Time) (int, error) {
+	expired, err := db.client.ZRangeByScore(db.serversKey(), &goredis.ZRangeBy{
+		Min: "(0",
+		Max: "(" + strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, address := range expired {
+		key := db.serverKey(address)
+
+		err = db.client.Watch(func(tx *goredis.Tx) error {
+			values, err := tx.HMGet(key, serverExpiresAtLabel, serverEventsLabel).Result()
+			if err != nil {
+				return err
+			}
+
+			// a heartbeat arrived after the servers were listed
+			if rawExpiresAt, isString := values[0].(string); isString {
+				expiresAt, _ := strconv.ParseInt(rawExpiresAt, 10, 64)
+				if expiresAt == 0 || expiresAt >= now.Unix() {
+					return errHeartbeatRace
+				}
+			}
+
+			events, _ := values[1].(string)
+			_, err = tx.TxPipelined(func(pipe goredis.Pipeliner) error {
+				db.deleteServer(pipe, address, events)
+				return nil
+			})
+			return err
+		}, key)
+
+		if err == errHeartbeatRace || err == goredis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+
+		log.WithFields(log.Fields{"server": address}).Info("expired chat server removed")
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+func (db storage) deleteServer(pipe goredis.Pipeliner, address string, events string) {
+	for _, subdomain := range splitEvents(events) {
+		pipe.SRem(db.eventServersKey(subdomain), address)
+	}
+	pipe.Del(db.serverKey(address))
+	pipe.ZRem(db.serversKey(), address)
+}
+
+func expiresAtScore(expiresAt time.Time) int64 {
+	if expiresAt.IsZero() {
+		return 0
+	}
+	return expiresAt.Unix()
+}
+
+func splitEvents(events string) []string {
+	if len(events) == 0 {
+		return nil
+	}
+	return strings.Split(events, eventsSeparator)
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+const (
+	serversPortLabel       = "port"
+	serverTypeLabel        = "server_type"
+	serverRegionLabel      = "region"
+	serverCapacityLabel    = "capacity"
+	serverLabelsLabel      = "labels"
+	serverEventsLabel      = "events"
+	serverHeartbeatAtLabel = "heartbeat_at"
+	serverExpiresAtLabel   = "expires_at"
+	eventsSeparator        = ","
+)
+
+// GetServerConnections gets every server of serverType
+func (db storage) GetServerConnections(ctx context.Context, serverType string) ([]store.ChatServer, error) {
+	addresses, err := db.client.WithContext(ctx).ZRange(db.serversKey(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.chatServers(ctx, addresses, serverType)
+}
+
+// GetEventServers gets the servers of serverType registered as hosting subdomain
+func (db storage) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]store.ChatServer, error) {
+	addresses, err := db.client.WithContext(ctx).SMembers(db.eventServersKey(subdomain)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.chatServers(ctx, addresses, serverType)
+}
+
+func (db storage) chatServers(ctx context.Context, addresses []string, serverType string) ([]store.ChatServer, error) {
+	servers := make([]store.ChatServer, 0, len(addresses))
+	if len(addresses) == 0 {
+		return servers, nil
+	}
+
+	pipe := db.client.WithContext(ctx).Pipeline()
+
+	cmds := make([]*goredis.SliceCmd, len(addresses))
+	for i, address := range addresses {
+		cmds[i] = pipe.HMGet(db.serverKey(address), serverTypeLabel, serversPortLabel, serverRegionLabel, serverCapacityLabel, serverLabelsLabel, serverEventsLabel)
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		itemType, isString := values[0].(string)
+		if !isString || itemType != serverType {
+			continue
+		}
+
+		rawPort, isString := values[1].(string)
+		if !isString {
+			continue
+		}
+
+		port, err := strconv.Atoi(rawPort)
+		if err != nil {
+			return nil, err
+		}
+
+		server := store.ChatServer{IP: store.AddressIP(addresses[i]), Port: port, ServerType: itemType}
+		server.Region, _ = values[2].(string)
+		if rawCapacity, isString := values[3].(string); isString {
+			server.Capacity, _ = strconv.Atoi(rawCapacity)
+		}
+		if rawLabels, isString := values[4].(string); isString && len(rawLabels) > 0 {
+			if err := json.Unmarshal([]byte(rawLabels), &server.Labels); err != nil {
+				return nil, err
+			}
+		}
+		if rawEvents, isString := values[5].(string); isString {
+			server.Events = splitEvents(rawEvents)
+		}
+
+		servers = append(servers, server)
+	}
+
+	return servers, nil
+}
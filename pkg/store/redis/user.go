@@ -0,0 +1,200 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+const (
+	audienceOrganizer  = "organizer"
+	audienceAttendance = "attendance"
+	streamPageSize     = 1000
+)
+
+// GetUserConnections gets the connections of subdomain audience, every connection of the
+// event is returned for an unknown audience
+func (db storage) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]store.Connection) error {
+	members, err := db.client.WithContext(ctx).SMembers(db.connectionsKey(subdomain, audienceType)).Result()
+	if err != nil {
+		return err
+	}
+
+	records, err := db.connectionRecords(ctx, subdomain, members)
+	if err != nil {
+		return err
+	}
+
+	*connections = append(*connections, records...)
+	return nil
+}
+
+// StreamUserConnections sends the connections of subdomain audience to pages while the set
+// is scanned, pages is not closed. SSCAN may return a member more than once so members
+// already sent are skipped
+func (db storage) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []store.Connection) error {
+	client := db.client.WithContext(ctx)
+	key := db.connectionsKey(subdomain, audienceType)
+	seen := make(map[string]bool)
+	var cursor uint64
+
+	for {
+		members, next, err := client.SScan(key, cursor, "", streamPageSize).Result()
+		if err != nil {
+			return err
+		}
+
+		page, err := db.connectionRecords(ctx, subdomain, unseen(members, seen))
+		if err != nil {
+			return err
+		}
+
+		if len(page) > 0 {
+			select {
+			case pages <- page:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// unseen filters out the members of seen and adds the rest to it
+func unseen(members []string, seen map[string]bool) []string {
+	fresh := members[:0]
+	for _, member := range members {
+		if !seen[member] {
+			seen[member] = true
+			fresh = append(fresh, member)
+		}
+	}
+	return fresh
+}
+
+// connectionRecords builds the records of ids, the projected attributes are read from the
+// connection hashes in a single round trip
+func (db storage) connectionRecords(ctx context.Context, subdomain string, ids []string) ([]store.Connection, error) {
+	records := make([]store.Connection, 0, len(ids))
+	for _, id := range ids {
+		if len(id) > 0 {
+			records = append(records, store.Connection{ConnectionID: id, EventSubdomain: subdomain})
+		}
+	}
+
+	fields := db.connectionFields()
+	if len(fields) == 0 || len(records) == 0 {
+		return records, nil
+	}
+
+	pipe := db.client.WithContext(ctx).Pipeline()
+
+	cmds := make([]*goredis.SliceCmd, len(records))
+	for i, record := range records {
+		cmds[i] = pipe.HMGet(db.connectionKey(record.ConnectionID), fields...)
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		for idx, value := range cmd.Val() {
+			if value, isString := value.(string); isString {
+				setAttribute(&records[i], fields[idx], value)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// connectionFields gets the projected attributes kept in connection hashes
+func (db storage) connectionFields() []string {
+	fields := make([]string, 0, len(db.attributes))
+	for _, attribute := range db.attributes {
+		switch attribute {
+		case store.AttrConnectionID, store.AttrEventSubdomain:
+		default:
+			fields = append(fields, attribute)
+		}
+	}
+	return fields
+}
+
+func setAttribute(conn *store.Connection, attribute string, value string) {
+	switch attribute {
+	case store.AttrEventSubdomain:
+		conn.EventSubdomain = value
+	case store.AttrUserID:
+		conn.UserID = value
+	case store.AttrIsOrganizer:
+		conn.IsOrganizer, _ = strconv.ParseBool(value)
+	case store.AttrConnectedAt:
+		conn.ConnectedAt, _ = time.Parse(time.RFC3339, value)
+	case store.AttrPlatform:
+		conn.Platform = value
+	case store.AttrLanguage:
+		conn.Language = value
+	case store.AttrGone:
+		conn.Gone, _ = strconv.ParseBool(value)
+	}
+}
+
+func (db storage) connectionsKey(subdomain string, audienceType string) string {
+	switch audienceType {
+	case audienceOrganizer, audienceAttendance:
+		return db.audienceKey(subdomain, audienceType)
+	}
+	return db.eventKey(subdomain)
+}
+
+// AddConnection adds conn to its event and audience sets and keeps its attributes
+func (db storage) AddConnection(ctx context.Context, conn store.Connection) error {
+	attributes := []interface{}{
+		store.AttrEventSubdomain, conn.EventSubdomain,
+		store.AttrUserID, conn.UserID,
+		store.AttrIsOrganizer, strconv.FormatBool(conn.IsOrganizer),
+		store.AttrPlatform, conn.Platform,
+		store.AttrLanguage, conn.Language,
+		store.AttrGone, strconv.FormatBool(conn.Gone),
+	}
+	if !conn.ConnectedAt.IsZero() {
+		attributes = append(attributes, store.AttrConnectedAt, conn.ConnectedAt.Format(time.RFC3339))
+	}
+
+	_, err := db.client.WithContext(ctx).TxPipelined(func(pipe goredis.Pipeliner) error {
+		pipe.SAdd(db.eventKey(conn.EventSubdomain), conn.ConnectionID)
+		pipe.SAdd(db.audienceKey(conn.EventSubdomain, audienceOf(conn)), conn.ConnectionID)
+		pipe.HSet(db.connectionKey(conn.ConnectionID), attributes...)
+		return nil
+	})
+
+	return err
+}
+
+// RemoveConnection removes conn from its event and audience sets
+func (db storage) RemoveConnection(ctx context.Context, conn store.Connection) error {
+	_, err := db.client.WithContext(ctx).TxPipelined(func(pipe goredis.Pipeliner) error {
+		pipe.SRem(db.eventKey(conn.EventSubdomain), conn.ConnectionID)
+		pipe.SRem(db.audienceKey(conn.EventSubdomain, audienceOf(conn)), conn.ConnectionID)
+		pipe.Del(db.connectionKey(conn.ConnectionID))
+		return nil
+	})
+
+	return err
+}
+
+func audienceOf(conn store.Connection) string {
+	if conn.IsOrganizer {
+		return audienceOrganizer
+	}
+	return audienceAttendance
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrServerNotRegistered is returned when a heartbeat arrives for an unknown chat server
+var ErrServerNotRegistered = errors.New("chat server is not registered")
+
+// ServerRegistration chat server self-registration data
+type ServerRegistration struct {
+	IP         string            `json:"ip"`
+	Port       int               `json:"port"`
+	ServerType string            `json:"server_type"`
+	Region     string            `json:"region,omitempty"`
+	Capacity   int               `json:"capacity"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Events     []string          `json:"events"`
+	ExpiresAt  time.Time         `json:"-"`
+}
+
+// ChatServer a chat server messages of its server type are published to
+type ChatServer struct {
+	IP         string            `json:"ip"`
+	Port       int               `json:"port"`
+	ServerType string            `json:"server_type"`
+	Region     string            `json:"region,omitempty"`
+	Capacity   int               `json:"capacity,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// Events the server is registered as hosting
+	Events []string `json:"events,omitempty"`
+}
+
+// Address gets the ip:port of the server, servers sharing a host are told apart by port
+func (cs ChatServer) Address() string {
+	return Address(cs.IP, cs.Port)
+}
+
+// Hosts tells if the server is registered as hosting subdomain
+func (cs ChatServer) Hosts(subdomain string) bool {
+	for _, event := range cs.Events {
+		if event == subdomain {
+			return true
+		}
+	}
+	return false
+}
+
+// Address gets the ip:port of the registration, registrations are keyed by it
+func (sr ServerRegistration) Address() string {
+	return Address(sr.IP, sr.Port)
+}
+
+// Address joins ip and port, chat servers are registered and tracked by it
+func Address(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// AddressIP gets the ip of a chat server registration key, the keys registered before they
+// were addresses are the ip alone
+func AddressIP(key string) string {
+	if ip, _, err := net.SplitHostPort(key); err == nil {
+		return ip
+	}
+	return key
+}
+
+// Connection attributes, the ones read by a store besides the connection id are configurable
+const (
+	AttrConnectionID   = "connection_id"
+	AttrEventSubdomain = "event_subdomain"
+	AttrUserID         = "user_id"
+	AttrIsOrganizer    = "is_organizer"
+	AttrConnectedAt    = "connected_at"
+	AttrPlatform       = "platform"
+	AttrLanguage       = "language"
+	// AttrGone flags connections the sender failed to deliver to because they are gone
+	AttrGone = "gone"
+)
+
+// ConnectionAttributes every attribute of a connection record
+var ConnectionAttributes = []string{
+	AttrConnectionID,
+	AttrEventSubdomain,
+	AttrUserID,
+	AttrIsOrganizer,
+	AttrConnectedAt,
+	AttrPlatform,
+	AttrLanguage,
+	AttrGone,
+}
+
+// ErrUnknownAttribute is returned when a projection names an attribute connections don't have
+var ErrUnknownAttribute = errors.New("unknown connection attribute")
+
+// Connection a websocket connection of an event audience, attributes out of the store
+// projection keep their zero value, a zero ConnectedAt means it is unknown
+type Connection struct {
+	ConnectionID   string    `json:"connection_id"`
+	EventSubdomain string    `json:"event_subdomain"`
+	UserID         string    `json:"user_id,omitempty"`
+	IsOrganizer    bool      `json:"is_organizer"`
+	ConnectedAt    time.Time `json:"connected_at"`
+	Platform       string    `json:"platform,omitempty"`
+	Language       string    `json:"language,omitempty"`
+	Gone           bool      `json:"gone,omitempty"`
+}
+
+// Projection validates attributes and returns them without duplicates, the connection id
+// is always the first one
+func Projection(attributes []string) ([]string, error) {
+	projection := []string{AttrConnectionID}
+	seen := map[string]bool{AttrConnectionID: true}
+
+	for _, attribute := range attributes {
+		if seen[attribute] {
+			continue
+		}
+		if !knownAttribute(attribute) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownAttribute, attribute)
+		}
+		seen[attribute] = true
+		projection = append(projection, attribute)
+	}
+
+	return projection, nil
+}
+
+func knownAttribute(attribute string) bool {
+	for _, known := range ConnectionAttributes {
+		if attribute == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionIDs gets the ids of connections
+func ConnectionIDs(connections []Connection) []string {
+	ids := make([]string, 0, len(connections))
+	for _, conn := range connections {
+		ids = append(ids, conn.ConnectionID)
+	}
+	return ids
+}
+
+// EventConfig per event dispatch settings, zero values keep the default behaviour
+type EventConfig struct {
+	EventSubdomain string `json:"event_subdomain"`
+	// DefaultGateway is used for the messages without gateway_type
+	DefaultGateway string `json:"default_gateway,omitempty"`
+	// Audiences enabled for the event, every audience is enabled when empty
+	Audiences []string `json:"audiences,omitempty"`
+	// RateLimit in messages per second with RateBurst messages of burst
+	RateLimit       float64 `json:"rate_limit,omitempty"`
+	RateBurst       int     `json:"rate_burst,omitempty"`
+	MaxMessageBytes int     `json:"max_message_bytes,omitempty"`
+	// Muted events drop their messages, paused events reject them
+	Muted  bool `json:"muted,omitempty"`
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Store is implemented by every connections and chat servers backend
+type Store interface {
+	GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]Connection) error
+	StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []Connection) error
+	// StreamStaleConnections sends the connections established before connectedBefore or
+	// flagged gone, a zero connectedBefore only matches gone connections
+	StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []Connection) error
+	DeleteConnections(ctx context.Context, connections []Connection) (int, error)
+	GetServerConnections(ctx context.Context, serverType string) ([]ChatServer, error)
+	GetEventServers(ctx context.Context, serverType string, subdomain string) ([]ChatServer, error)
+	RegisterServer(server ServerRegistration) error
+	HeartbeatServer(ip string, port int, expiresAt time.Time) error
+	DeregisterServer(ip string, port int) error
+	DeleteExpiredServers(now time.Time) (int, error)
+	GetEventConfigs(ctx context.Context, configs map[string]EventConfig) error
+}
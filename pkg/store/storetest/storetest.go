@@ -0,0 +1,336 @@
+// Package storetest holds the behaviour every store.Store backend must share
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/boletia/ws-message-dispatcher/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// Seed data written by the factory before a case runs
+type Seed struct {
+	Connections  []store.Connection
+	EventConfigs []store.EventConfig
+}
+
+// Factory creates an empty store seeded with seed, it must project every connection attribute
+type Factory func(t *testing.T, seed Seed) store.Store
+
+// Connections seeded on every user connections case
+var Connections = []store.Connection{
+	{
+		ConnectionID: "conn-organizer-1", EventSubdomain: "el-show-de-producto-online", UserID: "42", IsOrganizer: true,
+		ConnectedAt: time.Date(2020, 10, 1, 20, 0, 0, 0, time.UTC), Platform: "web", Language: "es",
+	},
+	{ConnectionID: "conn-attendance-1", EventSubdomain: "el-show-de-producto-online", UserID: "43", Language: "en"},
+	{ConnectionID: "conn-attendance-2", EventSubdomain: "el-show-de-producto-online"},
+	{ConnectionID: "conn-other-1", EventSubdomain: "otro-evento"},
+}
+
+// Run runs the store suite against the stores created by newStore
+func Run(t *testing.T, newStore Factory) {
+	t.Run("UserConnections", func(t *testing.T) { testUserConnections(t, newStore) })
+	t.Run("StreamUserConnections", func(t *testing.T) { testStreamUserConnections(t, newStore) })
+	t.Run("StaleConnections", func(t *testing.T) { testStaleConnections(t, newStore) })
+	t.Run("ServerConnections", func(t *testing.T) { testServerConnections(t, newStore) })
+	t.Run("ServerRegistration", func(t *testing.T) { testServerRegistration(t, newStore) })
+	t.Run("DeleteExpiredServers", func(t *testing.T) { testDeleteExpiredServers(t, newStore) })
+	t.Run("ServersSharingHost", func(t *testing.T) { testServersSharingHost(t, newStore) })
+	t.Run("EventConfigs", func(t *testing.T) { testEventConfigs(t, newStore) })
+}
+
+func testUserConnections(t *testing.T, newStore Factory) {
+	testCases := []struct {
+		testName            string
+		subdomain           string
+		audienceType        string
+		expectedConnections []string
+	}{
+		{
+			testName:            "AllAudiencesCase",
+			subdomain:           "el-show-de-producto-online",
+			expectedConnections: []string{"conn-organizer-1", "conn-attendance-1", "conn-attendance-2"},
+		},
+		{
+			testName:            "OrganizerCase",
+			subdomain:           "el-show-de-producto-online",
+			audienceType:        "organizer",
+			expectedConnections: []string{"conn-organizer-1"},
+		},
+		{
+			testName:            "AttendanceCase",
+			subdomain:           "el-show-de-producto-online",
+			audienceType:        "attendance",
+			expectedConnections: []string{"conn-attendance-1", "conn-attendance-2"},
+		},
+		{
+			testName:            "UnknownAudienceCase",
+			subdomain:           "otro-evento",
+			audienceType:        "staff",
+			expectedConnections: []string{"conn-other-1"},
+		},
+		{
+			testName:  "UnknownEventCase",
+			subdomain: "sin-conexiones",
+		},
+	}
+
+	db := newStore(t, Seed{Connections: Connections})
+
+	for _, c := range testCases {
+		t.Run(c.testName, func(t *testing.T) {
+			var connections []store.Connection
+			if assert.NoError(t, db.GetUserConnections(context.Background(), c.subdomain, c.audienceType, &connections)) {
+				assert.ElementsMatch(t, c.expectedConnections, store.ConnectionIDs(connections))
+			}
+		})
+	}
+
+	// records keep every attribute
+	var connections []store.Connection
+	if assert.NoError(t, db.GetUserConnections(context.Background(), "el-show-de-producto-online", "organizer", &connections)) {
+		assert.Equal(t, Connections[:1], connections)
+	}
+}
+
+func testStreamUserConnections(t *testing.T, newStore Factory) {
+	db := newStore(t, Seed{Connections: Connections})
+
+	pages := make(chan []store.Connection)
+	done := make(chan error, 1)
+	go func() {
+		done <- db.StreamUserConnections(context.Background(), "el-show-de-producto-online", "attendance", pages)
+		close(pages)
+	}()
+
+	var connections []store.Connection
+	for page := range pages {
+		assert.NotEmpty(t, page)
+		connections = append(connections, page...)
+	}
+
+	assert.NoError(t, <-done)
+	assert.ElementsMatch(t, Connections[1:3], connections)
+
+	// an abandoned stream gives up once ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, db.StreamUserConnections(ctx, "el-show-de-producto-online", "", make(chan []store.Connection)))
+}
+
+func testStaleConnections(t *testing.T, newStore Factory) {
+	now := time.Now().UTC().Truncate(time.Second)
+	subdomain := "el-show-de-producto-online"
+
+	db := newStore(t, Seed{Connections: []store.Connection{
+		{ConnectionID: "conn-old", EventSubdomain: subdomain, ConnectedAt: now.Add(-48 * time.Hour)},
+		{ConnectionID: "conn-fresh", EventSubdomain: subdomain, ConnectedAt: now.Add(-time.Hour)},
+		{ConnectionID: "conn-gone", EventSubdomain: subdomain, ConnectedAt: now.Add(-time.Hour), Gone: true, IsOrganizer: true},
+		{ConnectionID: "conn-unknown", EventSubdomain: subdomain},
+	}})
+
+	stale := func(connectedBefore time.Time) []store.Connection {
+		pages := make(chan []store.Connection)
+		done := make(chan error, 1)
+		go func() {
+			done <- db.StreamStaleConnections(context.Background(), connectedBefore, pages)
+			close(pages)
+		}()
+
+		var connections []store.Connection
+		for page := range pages {
+			assert.NotEmpty(t, page)
+			connections = append(connections, page...)
+		}
+		assert.NoError(t, <-done)
+		return connections
+	}
+
+	assert.ElementsMatch(t, []string{"conn-gone"}, store.ConnectionIDs(stale(time.Time{})))
+
+	connections := stale(now.Add(-24 * time.Hour))
+	assert.ElementsMatch(t, []string{"conn-old", "conn-gone"}, store.ConnectionIDs(connections))
+	for _, conn := range connections {
+		assert.Equal(t, subdomain, conn.EventSubdomain)
+	}
+
+	deleted, err := db.DeleteConnections(context.Background(), connections)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, deleted)
+	}
+
+	var remaining []store.Connection
+	if assert.NoError(t, db.GetUserConnections(context.Background(), subdomain, "", &remaining)) {
+		assert.ElementsMatch(t, []string{"conn-fresh", "conn-unknown"}, store.ConnectionIDs(remaining))
+	}
+
+	remaining = nil
+	if assert.NoError(t, db.GetUserConnections(context.Background(), subdomain, "organizer", &remaining)) {
+		assert.Empty(t, remaining)
+	}
+}
+
+func testServerConnections(t *testing.T, newStore Factory) {
+	db := newStore(t, Seed{})
+	ctx := context.Background()
+
+	registrations := []store.ServerRegistration{
+		{
+			IP: "10.0.0.1", Port: 8080, ServerType: "chat", Region: "us-east-1", Capacity: 5000,
+			Labels: map[string]string{"zone": "us-east-1a"}, Events: []string{"el-show-de-producto-online"},
+		},
+		{IP: "10.0.0.2", Port: 8081, ServerType: "chat", Events: []string{"otro-evento"}},
+		{IP: "10.0.0.3", Port: 9090, ServerType: "polls", Events: []string{"el-show-de-producto-online"}},
+	}
+	for _, server := range registrations {
+		assert.NoError(t, db.RegisterServer(server))
+	}
+
+	first := store.ChatServer{
+		IP: "10.0.0.1", Port: 8080, ServerType: "chat", Region: "us-east-1", Capacity: 5000,
+		Labels: map[string]string{"zone": "us-east-1a"}, Events: []string{"el-show-de-producto-online"},
+	}
+	second := store.ChatServer{IP: "10.0.0.2", Port: 8081, ServerType: "chat", Events: []string{"otro-evento"}}
+
+	servers, err := db.GetServerConnections(ctx, "chat")
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []store.ChatServer{first, second}, servers)
+	}
+
+	servers, err = db.GetEventServers(ctx, "chat", "el-show-de-producto-online")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []store.ChatServer{first}, servers)
+	}
+
+	servers, err = db.GetEventServers(ctx, "chat", "sin-servidores")
+	if assert.NoError(t, err) {
+		assert.Empty(t, servers)
+	}
+}
+
+func testServerRegistration(t *testing.T, newStore Factory) {
+	db := newStore(t, Seed{})
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Minute)
+
+	assert.Equal(t, store.ErrServerNotRegistered, db.HeartbeatServer("10.0.0.9", 8080, expiresAt))
+
+	assert.NoError(t, db.RegisterServer(store.ServerRegistration{
+		IP: "10.0.0.1", Port: 8080, ServerType: "chat", Events: []string{"el-show-de-producto-online"}, ExpiresAt: expiresAt,
+	}))
+	assert.NoError(t, db.HeartbeatServer("10.0.0.1", 8080, expiresAt.Add(time.Minute)))
+
+	// re-registering replaces the hosted events
+	assert.NoError(t, db.RegisterServer(store.ServerRegistration{
+		IP: "10.0.0.1", Port: 8080, ServerType: "chat", Events: []string{"otro-evento"}, ExpiresAt: expiresAt,
+	}))
+
+	servers, err := db.GetEventServers(ctx, "chat", "el-show-de-producto-online")
+	if assert.NoError(t, err) {
+		assert.Empty(t, servers)
+	}
+
+	assert.NoError(t, db.DeregisterServer("10.0.0.1", 8080))
+
+	servers, err = db.GetServerConnections(ctx, "chat")
+	if assert.NoError(t, err) {
+		assert.Empty(t, servers)
+	}
+	assert.Equal(t, store.ErrServerNotRegistered, db.HeartbeatServer("10.0.0.1", 8080, expiresAt))
+}
+
+func testDeleteExpiredServers(t *testing.T, newStore Factory) {
+	db := newStore(t, Seed{})
+	now := time.Now()
+
+	registrations := []store.ServerRegistration{
+		{IP: "10.0.0.1", Port: 8080, ServerType: "chat", ExpiresAt: now.Add(-time.Minute)},
+		{IP: "10.0.0.2", Port: 8080, ServerType: "chat", ExpiresAt: now.Add(time.Minute)},
+		{IP: "10.0.0.3", Port: 8080, ServerType: "chat"},
+	}
+	for _, server := range registrations {
+		assert.NoError(t, db.RegisterServer(server))
+	}
+
+	deleted, err := db.DeleteExpiredServers(now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, deleted)
+	}
+
+	servers, err := db.GetServerConnections(context.Background(), "chat")
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []store.ChatServer{
+			{IP: "10.0.0.2", Port: 8080, ServerType: "chat"},
+			{IP: "10.0.0.3", Port: 8080, ServerType: "chat"},
+		}, servers)
+	}
+}
+
+func testEventConfigs(t *testing.T, newStore Factory) {
+	expected := map[string]store.EventConfig{
+		"el-show-de-producto-online": {
+			EventSubdomain:  "el-show-de-producto-online",
+			DefaultGateway:  "chat-server-v2",
+			Audiences:       []string{"attendance"},
+			RateLimit:       2.5,
+			RateBurst:       5,
+			MaxMessageBytes: 4096,
+		},
+		"otro-evento": {
+			EventSubdomain: "otro-evento",
+			Paused:         true,
+		},
+	}
+
+	seed := Seed{}
+	for _, config := range expected {
+		seed.EventConfigs = append(seed.EventConfigs, config)
+	}
+
+	db := newStore(t, seed)
+
+	configs := map[string]store.EventConfig{}
+	if assert.NoError(t, db.GetEventConfigs(context.Background(), configs)) {
+		assert.Equal(t, expected, configs)
+	}
+}
+
+func testServersSharingHost(t *testing.T, newStore Factory) {
+	db := newStore(t, Seed{})
+	ctx := context.Background()
+	now := time.Now()
+
+	registrations := []store.ServerRegistration{
+		{IP: "10.0.0.1", Port: 8080, ServerType: "chat", Events: []string{"el-show-de-producto-online"}, ExpiresAt: now.Add(-time.Minute)},
+		{IP: "10.0.0.1", Port: 8081, ServerType: "chat", Events: []string{"el-show-de-producto-online"}, ExpiresAt: now.Add(time.Minute)},
+	}
+	for _, server := range registrations {
+		assert.NoError(t, db.RegisterServer(server))
+	}
+
+	first := store.ChatServer{IP: "10.0.0.1", Port: 8080, ServerType: "chat", Events: []string{"el-show-de-producto-online"}}
+	second := store.ChatServer{IP: "10.0.0.1", Port: 8081, ServerType: "chat", Events: []string{"el-show-de-producto-online"}}
+
+	servers, err := db.GetEventServers(ctx, "chat", "el-show-de-producto-online")
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []store.ChatServer{first, second}, servers)
+	}
+
+	// the heartbeat of one server doesn't extend the other
+	assert.NoError(t, db.HeartbeatServer("10.0.0.1", 8081, now.Add(time.Minute)))
+	deleted, err := db.DeleteExpiredServers(now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, deleted)
+	}
+
+	servers, err = db.GetServerConnections(ctx, "chat")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []store.ChatServer{second}, servers)
+	}
+
+	assert.NoError(t, db.DeregisterServer("10.0.0.1", 8081))
+	assert.Equal(t, store.ErrServerNotRegistered, db.HeartbeatServer("10.0.0.1", 8081, now))
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// generation is a store together with the calls still running on it
+type generation struct {
+	store Store
+	calls sync.WaitGroup
+}
+
+// Swappable is a Store whose backend is replaced on config reloads. Calls in flight finish on
+// the store they started with, which is closed once they are done when it is an io.Closer
+type Swappable struct {
+	mu      sync.RWMutex
+	current *generation
+}
+
+// NewSwappable creates a store serving from s until it is swapped
+func NewSwappable(s Store) *Swappable {
+	return &Swappable{current: &generation{store: s}}
+}
+
+// Swap serves the next calls from next
+func (sw *Swappable) Swap(next Store) {
+	sw.mu.Lock()
+	prev := sw.current
+	sw.current = &generation{store: next}
+	sw.mu.Unlock()
+
+	go func() {
+		prev.calls.Wait()
+
+		if closer, ok := prev.store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.WithFields(log.Fields{"error": err}).Warn("unable to close swapped store")
+			}
+		}
+	}()
+}
+
+// acquire gets the current generation, the caller must call calls.Done once finished
+func (sw *Swappable) acquire() *generation {
+	sw.mu.RLock()
+	defer sw.mu.RUnlock()
+
+	sw.current.calls.Add(1)
+	return sw.current
+}
+
+// GetUserConnections implements Store
+func (sw *Swappable) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]Connection) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.GetUserConnections(ctx, subdomain, audienceType, connections)
+}
+
+// StreamUserConnections implements Store
+func (sw *Swappable) StreamUserConnections(ctx context.Context, subdomain string, audienceType string, pages chan<- []Connection) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.StreamUserConnections(ctx, subdomain, audienceType, pages)
+}
+
+// StreamStaleConnections implements Store
+func (sw *Swappable) StreamStaleConnections(ctx context.Context, connectedBefore time.Time, pages chan<- []Connection) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.StreamStaleConnections(ctx, connectedBefore, pages)
+}
+
+// DeleteConnections implements Store
+func (sw *Swappable) DeleteConnections(ctx context.Context, connections []Connection) (int, error) {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.DeleteConnections(ctx, connections)
+}
+
+// GetServerConnections implements Store
+func (sw *Swappable) GetServerConnections(ctx context.Context, serverType string) ([]ChatServer, error) {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.GetServerConnections(ctx, serverType)
+}
+
+// GetEventServers implements Store
+func (sw *Swappable) GetEventServers(ctx context.Context, serverType string, subdomain string) ([]ChatServer, error) {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.GetEventServers(ctx, serverType, subdomain)
+}
+
+// RegisterServer implements Store
+func (sw *Swappable) RegisterServer(server ServerRegistration) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.RegisterServer(server)
+}
+
+// HeartbeatServer implements Store
+func (sw *Swappable) HeartbeatServer(ip string, port int, expiresAt time.Time) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.HeartbeatServer(ip, port, expiresAt)
+}
+
+// DeregisterServer implements Store
+func (sw *Swappable) DeregisterServer(ip string, port int) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.DeregisterServer(ip, port)
+}
+
+// DeleteExpiredServers implements Store
+func (sw *Swappable) DeleteExpiredServers(now time.Time) (int, error) {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.DeleteExpiredServers(now)
+}
+
+// GetEventConfigs implements Store
+func (sw *Swappable) GetEventConfigs(ctx context.Context, configs map[string]EventConfig) error {
+	g := sw.acquire()
+	defer g.calls.Done()
+	return g.store.GetEventConfigs(ctx, configs)
+}
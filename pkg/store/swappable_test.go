@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStore answers GetUserConnections with its name once release is closed
+type blockingStore struct {
+	Store
+	name    string
+	release chan struct{}
+	closed  int32
+}
+
+func (bs *blockingStore) GetUserConnections(ctx context.Context, subdomain string, audienceType string, connections *[]Connection) error {
+	<-bs.release
+	*connections = append(*connections, Connection{ConnectionID: bs.name})
+	return nil
+}
+
+func (bs *blockingStore) Close() error {
+	atomic.AddInt32(&bs.closed, 1)
+	return nil
+}
+
+func TestSwappable(t *testing.T) {
+	prev := &blockingStore{name: "prev", release: make(chan struct{})}
+	next := &blockingStore{name: "next", release: make(chan struct{})}
+	close(next.release)
+
+	sw := NewSwappable(prev)
+
+	inFlight := make(chan []Connection)
+	go func() {
+		var connections []Connection
+		sw.GetUserConnections(context.Background(), "show", "", &connections)
+		inFlight <- connections
+	}()
+
+	// the call above must hold prev before it is swapped
+	time.Sleep(10 * time.Millisecond)
+	sw.Swap(next)
+
+	var connections []Connection
+	assert.NoError(t, sw.GetUserConnections(context.Background(), "show", "", &connections))
+	assert.Equal(t, []string{"next"}, ConnectionIDs(connections))
+
+	// prev is only closed once its call is done
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&prev.closed))
+
+	close(prev.release)
+	assert.Equal(t, []string{"prev"}, ConnectionIDs(<-inFlight))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&prev.closed) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&next.closed))
+}